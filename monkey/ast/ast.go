@@ -6,10 +6,13 @@ import (
 	"strings"
 )
 
-// TODO(jan): add file and line number information for debug/error output
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Pos returns the position of the first character of the node,
+	// End the position directly after its last character.
+	Pos() token.Position
+	End() token.Position
 }
 
 type Statement interface {
@@ -22,6 +25,13 @@ type Expression interface {
 	expressionNode()
 }
 
+// Pattern is the target of a destructuring binding: an Identifier, an
+// ArrayPattern or a HashPattern
+type Pattern interface {
+	Node
+	patternNode()
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -33,6 +43,20 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -43,10 +67,16 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// LetStatement binds Value to Name, or to the identifiers of Pattern.
+// Bindings of a const statement, which is a LetStatement with a CONST
+// token, can't be assigned to.
 type LetStatement struct {
-	Token token.Token
+	Token token.Token // 'let' or 'const'
 	Name  *Identifier
-	Value Expression
+	// Pattern is set instead of Name if the statement destructures
+	// its value, like let [a, b] = pair;
+	Pattern Pattern
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode() {}
@@ -55,11 +85,22 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	return ls.target().End()
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	out.WriteString(ls.target().String())
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -69,17 +110,96 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+func (ls *LetStatement) target() Node {
+	if ls.Pattern != nil {
+		return ls.Pattern
+	}
+	return ls.Name
+}
+
+// IsConst reports whether the statement is a const statement
+func (ls *LetStatement) IsConst() bool {
+	return ls.Token.Type == token.CONST
+}
+
+// Names returns the identifiers bound by the statement
+func (ls *LetStatement) Names() []string {
+	if ls.Pattern != nil {
+		return PatternNames(ls.Pattern)
+	}
+	return []string{ls.Name.Value}
+}
+
+// ImportStatement binds the exports of the module at Path to Name
+type ImportStatement struct {
+	Token token.Token // 'import'
+	Path  *StringLiteral
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode() {}
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *ImportStatement) Pos() token.Position {
+	return is.Token.Pos
+}
+func (is *ImportStatement) End() token.Position {
+	return is.Name.End()
+}
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString("\"" + is.Path.Value + "\"")
+	out.WriteString(" as ")
+	out.WriteString(is.Name.String())
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// ExportStatement is a let or const statement at the top level of a module whose
+// names can be used by the modules importing it
+type ExportStatement struct {
+	Token token.Token // 'export'
+	Let   *LetStatement
+}
+
+func (es *ExportStatement) statementNode() {}
+func (es *ExportStatement) TokenLiteral() string {
+	return es.Token.Literal
+}
+func (es *ExportStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+func (es *ExportStatement) End() token.Position {
+	return es.Let.End()
+}
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Let.String()
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
 }
 
 func (i *Identifier) expressionNode() {}
+func (i *Identifier) patternNode()    {}
 
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -95,6 +215,17 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -107,6 +238,27 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ThrowStatement raises Value as an exception, to be caught by the
+// innermost try expression around it
+type ThrowStatement struct {
+	Token token.Token // 'throw'
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+func (ts *ThrowStatement) Pos() token.Position {
+	return ts.Token.Pos
+}
+func (ts *ThrowStatement) End() token.Position {
+	return ts.Value.End()
+}
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
 type ExpressionStatement struct {
 	// first Token of the Expression
 	Token      token.Token
@@ -119,6 +271,20 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression != nil {
+		return es.Expression.Pos()
+	}
+	return es.Token.Pos
+}
+
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -137,10 +303,41 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
+
 func (il *IntegerLiteral) String() string {
 	return il.TokenLiteral()
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FloatLiteral) End() token.Position {
+	return fl.Token.End
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.TokenLiteral()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -152,6 +349,14 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
+
 func (b *Boolean) String() string {
 	return b.TokenLiteral()
 }
@@ -165,6 +370,12 @@ func (s *StringLiteral) expressionNode() {}
 func (s *StringLiteral) TokenLiteral() string {
 	return s.Token.Literal
 }
+func (s *StringLiteral) Pos() token.Position {
+	return s.Token.Pos
+}
+func (s *StringLiteral) End() token.Position {
+	return s.Token.End
+}
 func (s *StringLiteral) String() string {
 	return s.TokenLiteral()
 }
@@ -172,12 +383,19 @@ func (s *StringLiteral) String() string {
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rsquare  token.Token
 }
 
 func (a *ArrayLiteral) expressionNode() {}
 func (a *ArrayLiteral) TokenLiteral() string {
 	return a.Token.Literal
 }
+func (a *ArrayLiteral) Pos() token.Position {
+	return a.Token.Pos
+}
+func (a *ArrayLiteral) End() token.Position {
+	return a.Rsquare.End
+}
 func (a *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -192,16 +410,44 @@ func (a *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// PropagateExpression is Value?, it returns Value from the enclosing
+// function if it is an error and evaluates to it otherwise
+type PropagateExpression struct {
+	Token token.Token // '?'
+	Value Expression
+}
+
+func (pe *PropagateExpression) expressionNode() {}
+func (pe *PropagateExpression) TokenLiteral() string {
+	return pe.Token.Literal
+}
+func (pe *PropagateExpression) Pos() token.Position {
+	return pe.Value.Pos()
+}
+func (pe *PropagateExpression) End() token.Position {
+	return pe.Token.End
+}
+func (pe *PropagateExpression) String() string {
+	return "(" + pe.Value.String() + "?)"
+}
+
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token   token.Token
+	Left    Expression
+	Index   Expression
+	Rsquare token.Token
 }
 
 func (i *IndexExpression) expressionNode() {}
 func (i *IndexExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *IndexExpression) Pos() token.Position {
+	return i.Left.Pos()
+}
+func (i *IndexExpression) End() token.Position {
+	return i.Rsquare.End
+}
 func (i *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -227,6 +473,14 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+func (pe *PrefixExpression) End() token.Position {
+	return pe.Right.End()
+}
+
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -251,6 +505,14 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *InfixExpression) Pos() token.Position {
+	return ie.Left.Pos()
+}
+
+func (ie *InfixExpression) End() token.Position {
+	return ie.Right.End()
+}
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -263,6 +525,36 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression assigns Value to Target, which is either an
+// Identifier or an IndexExpression
+type AssignExpression struct {
+	Token  token.Token // '='
+	Target Expression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Target.Pos()
+}
+func (ae *AssignExpression) End() token.Position {
+	return ae.Value.End()
+}
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -274,6 +566,15 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -288,15 +589,66 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression evaluates to the value of Block, or to the value of
+// Catch if Block throws. Param is bound to the exception in Catch and
+// Finally runs after both. Either Catch or Finally may be nil, Param
+// may be nil too.
+type TryExpression struct {
+	Token   token.Token // 'try'
+	Block   *BlockStatement
+	Param   *Identifier
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	return te.Catch.End()
+}
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Param != nil {
+			out.WriteString("(" + te.Param.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rcurly     token.Token
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+func (bs *BlockStatement) End() token.Position {
+	return bs.Rcurly.End
+}
 
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
@@ -309,19 +661,37 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token // 'fn'
 	Parameters []*Identifier
-	Body       *BlockStatement
-	Name       string
+	// Defaults holds the default value of each parameter, or nil if
+	// the parameter has none. Only trailing parameters have defaults.
+	Defaults []Expression
+	// Rest collects the arguments after the last parameter, if set
+	Rest *Identifier
+	Body *BlockStatement
+	Name string
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+func (fl *FunctionLiteral) End() token.Position {
+	return fl.Body.End()
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+fl.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
 	}
 	out.WriteString(fl.TokenLiteral())
 	if fl.Name != "" {
@@ -339,12 +709,19 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token
 }
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *CallExpression) Pos() token.Position {
+	return ce.Function.Pos()
+}
+func (ce *CallExpression) End() token.Position {
+	return ce.Rparen.End
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -358,15 +735,94 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is Left[Low:High], either bound may be left out
+type SliceExpression struct {
+	Token   token.Token // '['
+	Left    Expression
+	Low     Expression
+	High    Expression
+	Rsquare token.Token
+}
+
+func (se *SliceExpression) expressionNode() {}
+func (se *SliceExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SliceExpression) Pos() token.Position {
+	return se.Left.Pos()
+}
+func (se *SliceExpression) End() token.Position {
+	return se.Rsquare.End
+}
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// MethodCallExpression calls the method Method of Receiver, or the
+// function stored under that key if Receiver is a hash
+type MethodCallExpression struct {
+	Token     token.Token // '.'
+	Receiver  Expression
+	Method    *Identifier
+	Arguments []Expression
+	Rparen    token.Token
+}
+
+func (mc *MethodCallExpression) expressionNode() {}
+func (mc *MethodCallExpression) TokenLiteral() string {
+	return mc.Token.Literal
+}
+func (mc *MethodCallExpression) Pos() token.Position {
+	return mc.Receiver.Pos()
+}
+func (mc *MethodCallExpression) End() token.Position {
+	return mc.Rparen.End
+}
+func (mc *MethodCallExpression) String() string {
+	var out bytes.Buffer
+	args := []string{}
+	for _, arg := range mc.Arguments {
+		args = append(args, arg.String())
+	}
+	out.WriteString(mc.Receiver.String())
+	out.WriteString(".")
+	out.WriteString(mc.Method.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	Rcurly token.Token
 }
 
 func (h *HashLiteral) expressionNode() {}
 func (h *HashLiteral) TokenLiteral() string {
 	return h.Token.Literal
 }
+func (h *HashLiteral) Pos() token.Position {
+	return h.Token.Pos
+}
+func (h *HashLiteral) End() token.Position {
+	return h.Rcurly.End
+}
 func (h *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
@@ -389,6 +845,12 @@ func (m *MacroLiteral) expressionNode() {}
 func (m *MacroLiteral) TokenLiteral() string {
 	return m.Token.Literal
 }
+func (m *MacroLiteral) Pos() token.Position {
+	return m.Token.Pos
+}
+func (m *MacroLiteral) End() token.Position {
+	return m.Body.End()
+}
 func (m *MacroLiteral) String() string {
 	var out bytes.Buffer
 
@@ -405,3 +867,328 @@ func (m *MacroLiteral) String() string {
 
 	return out.String()
 }
+
+type WhileStatement struct {
+	Token     token.Token // 'while'
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+func (ws *WhileStatement) Pos() token.Position {
+	return ws.Token.Pos
+}
+func (ws *WhileStatement) End() token.Position {
+	return ws.Body.End()
+}
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+	return out.String()
+}
+
+type ForInStatement struct {
+	Token    token.Token // 'for'
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode() {}
+func (fs *ForInStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForInStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+func (fs *ForInStatement) End() token.Position {
+	return fs.Body.End()
+}
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for")
+	out.WriteString("(")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+func (bs *BreakStatement) End() token.Position {
+	return bs.Token.End
+}
+func (bs *BreakStatement) String() string {
+	return bs.TokenLiteral() + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+func (cs *ContinueStatement) End() token.Position {
+	return cs.Token.End
+}
+func (cs *ContinueStatement) String() string {
+	return cs.TokenLiteral() + ";"
+}
+
+// SpreadExpression expands the elements of an array into an array
+// literal or the arguments of a call
+type SpreadExpression struct {
+	Token token.Token // '...'
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SpreadExpression) Pos() token.Position {
+	return se.Token.Pos
+}
+func (se *SpreadExpression) End() token.Position {
+	return se.Value.End()
+}
+func (se *SpreadExpression) String() string {
+	return se.TokenLiteral() + se.Value.String()
+}
+
+// ArrayPattern destructures an array into its Elements, Rest collects
+// the remaining elements if it is set
+type ArrayPattern struct {
+	Token    token.Token // '['
+	Elements []Pattern
+	Rest     *Identifier
+	Rsquare  token.Token
+}
+
+func (ap *ArrayPattern) patternNode() {}
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+func (ap *ArrayPattern) Pos() token.Position {
+	return ap.Token.Pos
+}
+func (ap *ArrayPattern) End() token.Position {
+	return ap.Rsquare.End
+}
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	els := []string{}
+	for _, el := range ap.Elements {
+		els = append(els, el.String())
+	}
+	if ap.Rest != nil {
+		els = append(els, "..."+ap.Rest.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(els, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashPattern destructures a hash by its string keys, {name} binds the
+// value of "name" to name, {name: n} binds it to n.
+type HashPattern struct {
+	Token  token.Token // '{'
+	Keys   []*Identifier
+	Values []Pattern
+	Rcurly token.Token
+}
+
+func (hp *HashPattern) patternNode() {}
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+func (hp *HashPattern) Pos() token.Position {
+	return hp.Token.Pos
+}
+func (hp *HashPattern) End() token.Position {
+	return hp.Rcurly.End
+}
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		if ident, ok := hp.Values[i].(*Identifier); ok && ident.Value == key.Value {
+			pairs = append(pairs, key.String())
+		} else {
+			pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+		}
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// PatternNames returns the identifiers bound by pattern, in order
+func PatternNames(pattern Pattern) []string {
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		return []string{pattern.Value}
+	case *ArrayPattern:
+		names := []string{}
+		for _, el := range pattern.Elements {
+			names = append(names, PatternNames(el)...)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest.Value)
+		}
+		return names
+	case *HashPattern:
+		names := []string{}
+		for _, value := range pattern.Values {
+			names = append(names, PatternNames(value)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// LiteralPattern matches values equal to a literal, it only occurs in
+// match arms
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode() {}
+func (lp *LiteralPattern) TokenLiteral() string {
+	return lp.Value.TokenLiteral()
+}
+func (lp *LiteralPattern) Pos() token.Position {
+	return lp.Value.Pos()
+}
+func (lp *LiteralPattern) End() token.Position {
+	return lp.Value.End()
+}
+func (lp *LiteralPattern) String() string {
+	return lp.Value.String()
+}
+
+// MatchExpression evaluates the Body of the first of its Arms whose
+// Pattern matches Subject and whose Guard, if any, is truthy
+type MatchExpression struct {
+	Token   token.Token // 'match'
+	Subject Expression
+	Arms    []*MatchArm
+	Rcurly  token.Token
+}
+
+// MatchArm is a single pattern => body case of a MatchExpression. The
+// identifier _ matches anything without binding it.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+	return out.String()
+}
+
+func (me *MatchExpression) expressionNode() {}
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+func (me *MatchExpression) Pos() token.Position {
+	return me.Token.Pos
+}
+func (me *MatchExpression) End() token.Position {
+	return me.Rcurly.End
+}
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	out.WriteString("match")
+	out.WriteString(me.Subject.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// BadStatement stands in for a statement that contained syntax errors,
+// From and To are its first and last token. Partial is the statement as
+// far as it could be parsed, or nil if the parser gave up on it early.
+type BadStatement struct {
+	From    token.Token
+	To      token.Token
+	Partial Statement
+}
+
+func (bs *BadStatement) statementNode() {}
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.From.Literal
+}
+func (bs *BadStatement) Pos() token.Position {
+	return bs.From.Pos
+}
+func (bs *BadStatement) End() token.Position {
+	return bs.To.End
+}
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
+
+// BadExpression stands in for an expression that could not be parsed
+type BadExpression struct {
+	Token token.Token
+}
+
+func (be *BadExpression) expressionNode() {}
+func (be *BadExpression) TokenLiteral() string {
+	return be.Token.Literal
+}
+func (be *BadExpression) Pos() token.Position {
+	return be.Token.Pos
+}
+func (be *BadExpression) End() token.Position {
+	return be.Token.End
+}
+func (be *BadExpression) String() string {
+	return "<bad expression>"
+}
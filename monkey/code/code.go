@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"monkey/token"
 )
 
 const (
@@ -15,11 +16,22 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
 	OpEqual
 	OpNotEqual
 	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
 	OpMinus
 	OpBang
+	OpBitNot
 	OpJumpNotTruthy
 	OpJump
 	OpNull
@@ -37,6 +49,27 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpIterInit
+	OpIterNext
+	OpSetFree
+	OpGetLocalCell
+	OpGetFreeCell
+	OpSetIndex
+	OpUnpackArray
+	OpUnpackHash
+	OpArraySpread
+	OpCallSpread
+	OpMatchEqual
+	OpMatchArray
+	OpMatchHash
+	OpGetMethod
+	OpSlice
+	OpImport
+	OpTry
+	OpTryFinally
+	OpEndTry
+	OpThrow
+	OpIsError
 )
 
 var definitions = map[Opcode]*Definition{
@@ -47,13 +80,24 @@ var definitions = map[Opcode]*Definition{
 	OpSub:            {"OpSub", []int{}},
 	OpMul:            {"OpMul", []int{}},
 	OpDiv:            {"OpDiv", []int{}},
+	OpMod:            {"OpMod", []int{}},
+	OpPow:            {"OpPow", []int{}},
+	OpBitAnd:         {"OpBitAnd", []int{}},
+	OpBitOr:          {"OpBitOr", []int{}},
+	OpBitXor:         {"OpBitXor", []int{}},
+	OpShiftLeft:      {"OpShiftLeft", []int{}},
+	OpShiftRight:     {"OpShiftRight", []int{}},
 	OpTrue:           {"OpTrue", []int{}},
 	OpFalse:          {"OpFalse", []int{}},
 	OpEqual:          {"OpEqual", []int{}},
 	OpNotEqual:       {"OpNotEqual", []int{}},
 	OpGreaterThan:    {"OpGreaterThan", []int{}},
+	OpGreaterEqual:   {"OpGreaterEqual", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpLessEqual:      {"OpLessEqual", []int{}},
 	OpMinus:          {"OpMinus", []int{}},
 	OpBang:           {"OpBang", []int{}},
+	OpBitNot:         {"OpBitNot", []int{}},
 	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
 	OpJump:           {"OpJump", []int{2}},
 	OpGetGlobal:      {"OpGetGlobal", []int{2}},
@@ -70,6 +114,27 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpIterInit:       {"OpIterInit", []int{}},
+	OpIterNext:       {"OpIterNext", []int{2}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpGetLocalCell:   {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:    {"OpGetFreeCell", []int{1}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpUnpackArray:    {"OpUnpackArray", []int{2, 1}},
+	OpUnpackHash:     {"OpUnpackHash", []int{2}},
+	OpArraySpread:    {"OpArraySpread", []int{2}},
+	OpCallSpread:     {"OpCallSpread", []int{}},
+	OpMatchEqual:     {"OpMatchEqual", []int{}},
+	OpMatchArray:     {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:      {"OpMatchHash", []int{2}},
+	OpGetMethod:      {"OpGetMethod", []int{2}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpImport:         {"OpImport", []int{2}},
+	OpTry:            {"OpTry", []int{2}},
+	OpTryFinally:     {"OpTryFinally", []int{2}},
+	OpEndTry:         {"OpEndTry", []int{}},
+	OpThrow:          {"OpThrow", []int{}},
+	OpIsError:        {"OpIsError", []int{}},
 }
 
 type Instructions []byte
@@ -109,6 +174,25 @@ func (in Instructions) fmtInstruction(def *Definition, operands []int) string {
 
 type Opcode byte
 
+// SourceMap records the source position each instruction was compiled
+// from, ordered by instruction offset.
+type SourceMap []SourceMapping
+
+type SourceMapping struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Lookup returns the position of the instruction that contains offset
+func (sm SourceMap) Lookup(offset int) token.Position {
+	for i := len(sm) - 1; i >= 0; i-- {
+		if sm[i].Offset <= offset {
+			return sm[i].Pos
+		}
+	}
+	return token.Position{}
+}
+
 type Definition struct {
 	Name     string
 	OpWidths []int
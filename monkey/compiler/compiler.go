@@ -5,6 +5,7 @@ import (
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
+	"monkey/token"
 	"sort"
 )
 
@@ -15,13 +16,39 @@ type EmittedInstruction struct {
 
 type CopmilationScope struct {
 	instructions        code.Instructions
+	sourceMap           code.SourceMap
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	// loops enclosing the code being compiled, innermost last
+	loops []*Loop
+	// tries whose handlers are active in the code being compiled,
+	// innermost last
+	tries []*Try
+}
+
+// Loop tracks the jump targets of a loop being compiled
+type Loop struct {
+	// continuePos is where a continue jumps to
+	continuePos int
+	// breakJumps are the positions of the OpJumps emitted for break,
+	// they get patched to the end of the loop once it is known
+	breakJumps []int
+	// tries is the number of tries around the loop, break and continue
+	// leave the ones inside of it
+	tries int
+}
+
+// Try tracks a try expression whose exception handler is active
+type Try struct {
+	// finally has to run before control leaves the try early, it is nil
+	// if there is no finally block
+	finally *ast.BlockStatement
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap
 }
 
 type Compiler struct {
@@ -29,6 +56,8 @@ type Compiler struct {
 	symTable   *SymbolTable
 	scopes     []CopmilationScope
 	scopeIndex int
+	// position of the node currently being compiled
+	pos token.Position
 }
 
 func New() *Compiler {
@@ -58,7 +87,20 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if node == nil {
+		return nil
+	}
+	// nodes created by macro expansion carry no position,
+	// attribute them to their parent instead
+	if pos := node.Pos(); pos.IsValid() {
+		outerPos := c.pos
+		c.pos = pos
+		defer func() { c.pos = outerPos }()
+	}
+
 	switch node := node.(type) {
+	case *ast.BadStatement, *ast.BadExpression:
+		return fmt.Errorf("%s: cannot compile invalid syntax", c.pos)
 	case *ast.Program:
 		for _, statement := range node.Statements {
 			err := c.Compile(statement)
@@ -88,10 +130,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
 	case *ast.ArrayLiteral:
+		if hasSpread(node.Elements) {
+			return c.compileSpreadList(node.Elements)
+		}
 		for _, el := range node.Elements {
 			err := c.Compile(el)
 			if err != nil {
@@ -122,23 +170,111 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpHash, len(node.Pairs)*2)
 
 	case *ast.LetStatement:
-		symbol := c.symTable.Define(node.Name.Value)
+		if node.Pattern != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			return c.bindPattern(node.Pattern)
+		}
+		// the value sees the binding the name had before the statement
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
+		symbol, err := c.define(node.Name)
+		if err != nil {
+			return err
+		}
+		if node.IsConst() {
+			symbol = c.symTable.DefineConst(node.Name.Value, node.Name.Pos())
+		}
+		c.storeSymbol(symbol)
+	case *ast.ImportStatement:
+		c.emit(code.OpImport, c.addConstant(&object.String{Value: node.Path.Value}))
+		symbol, err := c.define(node.Name)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+	case *ast.ExportStatement:
+		return c.Compile(node.Let)
+	case *ast.WhileStatement:
+		loopStart := len(c.currentInstructions())
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 42069)
 
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		c.enterLoop(loopStart)
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loopStart)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		c.leaveLoop(afterLoopPos)
+	case *ast.ForInStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
 		}
+		c.emit(code.OpIterInit)
+		// the iterator lives in a slot of its own, "$" keeps the name
+		// from clashing with any identifier
+		iterator := c.symTable.DefineHidden("$iterator")
+		c.storeSymbol(iterator)
+
+		loopStart := len(c.currentInstructions())
+		c.loadSymbol(iterator)
+		iterNextPos := c.emit(code.OpIterNext, 42069)
+		variable, err := c.define(node.Variable)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(variable)
+
+		c.enterLoop(loopStart)
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loopStart)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(iterNextPos, afterLoopPos)
+		c.leaveLoop(afterLoopPos)
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("%s: break outside of loop", node.Pos())
+		}
+		err := c.leaveTries(loop.tries)
+		if err != nil {
+			return err
+		}
+		loop.breakJumps = append(loop.breakJumps, c.emit(code.OpJump, 42069))
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("%s: continue outside of loop", node.Pos())
+		}
+		err := c.leaveTries(loop.tries)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.continuePos)
 	case *ast.Identifier:
 		sym, ok := c.symTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return fmt.Errorf("%s: undefined variable %s", node.Pos(), node.Value)
 		}
 		c.loadSymbol(sym)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
 		if err != nil {
@@ -150,17 +286,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(op)
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
 		}
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -175,6 +302,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(op)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -206,6 +337,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jmpPos, afterAlternativePos)
+	case *ast.PropagateExpression:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		// returns the value, which stays on the stack, if it is an error
+		c.emit(code.OpIsError)
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 42069)
+		err = c.leaveTries(0)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -217,6 +362,23 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		// left out bounds are passed as null
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
 	case *ast.FunctionLiteral:
 		c.enterScope()
 
@@ -224,8 +386,34 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.symTable.DefineFunctionName(node.Name)
 		}
 
+		params := []Symbol{}
 		for _, param := range node.Parameters {
-			c.symTable.Define(param.Value)
+			params = append(params, c.symTable.Define(param.Value))
+		}
+		if node.Rest != nil {
+			c.symTable.Define(node.Rest.Value)
+		}
+
+		// a call with i missing arguments starts at the default value of
+		// the i-th last parameter and computes the rest from there on
+		minParams := len(node.Parameters)
+		entries := []int{}
+		for i, def := range node.Defaults {
+			if def == nil {
+				continue
+			}
+			if len(entries) == 0 {
+				minParams = i
+			}
+			entries = append(entries, len(c.currentInstructions()))
+			err := c.Compile(def)
+			if err != nil {
+				return err
+			}
+			c.storeSymbol(params[i])
+		}
+		if len(entries) > 0 {
+			entries = append(entries, len(c.currentInstructions()))
 		}
 
 		err := c.Compile(node.Body)
@@ -241,16 +429,21 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symTable.FreeSymbols
 		numLocals := c.symTable.numDefinitions
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.loadCell(s)
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			MinParameters: minParams,
+			Variadic:      node.Rest != nil,
+			Entries:       entries,
+			SourceMap:     sourceMap,
 		}
 
 		fnIdx := c.addConstant(compiledFn)
@@ -260,20 +453,96 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		err = c.leaveTries(0)
+		if err != nil {
+			return err
+		}
 		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
 		if err != nil {
 			return err
 		}
-		for _, argument := range node.Arguments {
-			err := c.Compile(argument)
+		return c.compileArguments(node.Arguments)
+	case *ast.MethodCallExpression:
+		err := c.Compile(node.Receiver)
+		if err != nil {
+			return err
+		}
+		name := &object.String{Value: node.Method.Value}
+		c.emit(code.OpGetMethod, c.addConstant(name))
+		return c.compileArguments(node.Arguments)
+	}
+	return nil
+}
+
+// compileArguments compiles the arguments of a call and the call itself
+func (c *Compiler) compileArguments(arguments []ast.Expression) error {
+	if hasSpread(arguments) {
+		err := c.compileSpreadList(arguments)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpCallSpread)
+		return nil
+	}
+	for _, argument := range arguments {
+		err := c.Compile(argument)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpCall, len(arguments))
+	return nil
+}
+
+func hasSpread(exps []ast.Expression) bool {
+	for _, exp := range exps {
+		if _, ok := exp.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadList leaves a single array holding the values of exps on
+// the stack. Runs of plain elements are collected with OpArray, and the
+// parts are concatenated at runtime by OpArraySpread
+func (c *Compiler) compileSpreadList(exps []ast.Expression) error {
+	parts, pending := 0, 0
+	flush := func() {
+		if pending > 0 {
+			c.emit(code.OpArray, pending)
+			parts++
+			pending = 0
+		}
+	}
+
+	for _, exp := range exps {
+		spread, ok := exp.(*ast.SpreadExpression)
+		if !ok {
+			err := c.Compile(exp)
 			if err != nil {
 				return err
 			}
+			pending++
+			continue
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+		flush()
+		err := c.Compile(spread.Value)
+		if err != nil {
+			return err
+		}
+		parts++
 	}
+	flush()
+	c.emit(code.OpArraySpread, parts)
 	return nil
 }
 
@@ -281,6 +550,7 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
 
@@ -294,6 +564,10 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].sourceMap = append(
+		c.scopes[c.scopeIndex].sourceMap,
+		code.SourceMapping{Offset: pos, Pos: c.pos},
+	)
 	return pos
 }
 
@@ -317,6 +591,45 @@ func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
 
 }
 
+// compileLogicalExpression compiles && and || to conditional jumps,
+// so the right operand is only evaluated if it is needed. Both
+// operators always leave a boolean on the stack.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 42069)
+	var jumpEndPositions []int
+
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		jumpEndPositions = append(jumpEndPositions, c.emit(code.OpJump, 42069))
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	rightNotTruthyPos := c.emit(code.OpJumpNotTruthy, 42069)
+	c.emit(code.OpTrue)
+	jumpEndPositions = append(jumpEndPositions, c.emit(code.OpJump, 42069))
+
+	falsePos := len(c.currentInstructions())
+	c.changeOperand(rightNotTruthyPos, falsePos)
+	if node.Operator == "&&" {
+		c.changeOperand(jumpNotTruthyPos, falsePos)
+	}
+	c.emit(code.OpFalse)
+
+	afterPos := len(c.currentInstructions())
+	for _, pos := range jumpEndPositions {
+		c.changeOperand(pos, afterPos)
+	}
+	return nil
+}
+
 func getInfixOperator(opString string) (op code.Opcode, err error) {
 	switch opString {
 	case "+":
@@ -327,8 +640,28 @@ func getInfixOperator(opString string) (op code.Opcode, err error) {
 		return code.OpMul, nil
 	case "/":
 		return code.OpDiv, nil
+	case "%":
+		return code.OpMod, nil
+	case "**":
+		return code.OpPow, nil
+	case "&":
+		return code.OpBitAnd, nil
+	case "|":
+		return code.OpBitOr, nil
+	case "^":
+		return code.OpBitXor, nil
+	case "<<":
+		return code.OpShiftLeft, nil
+	case ">>":
+		return code.OpShiftRight, nil
 	case ">":
 		return code.OpGreaterThan, nil
+	case ">=":
+		return code.OpGreaterEqual, nil
+	case "<":
+		return code.OpLessThan, nil
+	case "<=":
+		return code.OpLessEqual, nil
 	case "==":
 		return code.OpEqual, nil
 	case "!=":
@@ -343,6 +676,8 @@ func getPrefixOperator(opString string) (op code.Opcode, err error) {
 		return code.OpMinus, nil
 	case "!":
 		return code.OpBang, nil
+	case "~":
+		return code.OpBitNot, nil
 	}
 	return 0, fmt.Errorf("unkown operator %s", opString)
 }
@@ -363,6 +698,12 @@ func (c *Compiler) removeLastInstruction() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	for len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Offset >= last.Position {
+		sourceMap = sourceMap[:len(sourceMap)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sourceMap
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
@@ -404,6 +745,406 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// bindPattern destructures the value on top of the stack into the
+// identifiers of pattern. OpUnpackArray and OpUnpackHash check the shape
+// of the value and leave its parts on the stack, first part on top.
+// Lowering to OpIndex instead would not do: it yields null for missing
+// elements and keys and a single OpIndex cannot slice off the rest, so
+// the wrong shapes the evaluator rejects would go through silently.
+func (c *Compiler) bindPattern(pattern ast.Pattern) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		symbol, err := c.define(pattern)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+	case *ast.ArrayPattern:
+		hasRest := 0
+		if pattern.Rest != nil {
+			hasRest = 1
+		}
+		c.emit(code.OpUnpackArray, len(pattern.Elements), hasRest)
+		for _, el := range pattern.Elements {
+			err := c.bindPattern(el)
+			if err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			return c.bindPattern(pattern.Rest)
+		}
+	case *ast.HashPattern:
+		for _, key := range pattern.Keys {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: key.Value}))
+		}
+		c.emit(code.OpUnpackHash, len(pattern.Keys))
+		for _, value := range pattern.Values {
+			err := c.bindPattern(value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// define defines the name of ident in the current scope, where a
+// constant of that name cannot be defined again
+func (c *Compiler) define(ident *ast.Identifier) (Symbol, error) {
+	if symbol, ok := c.symTable.Local(ident.Value); ok && symbol.Const &&
+		(symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return Symbol{}, fmt.Errorf("%s: cannot assign to constant %s, declared at %s", ident.Pos(), ident.Value, symbol.Declared)
+	}
+	return c.symTable.Define(ident.Value), nil
+}
+
+// compileMatchExpression compiles the arms of a match into a sequence
+// of tests, each failing test jumps on to the next arm
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	err := c.Compile(node.Subject)
+	if err != nil {
+		return err
+	}
+	subject := c.symTable.DefineHidden("$match")
+	c.storeSymbol(subject)
+
+	endJumps := []int{}
+	for _, arm := range node.Arms {
+		// the variables of an arm only exist within the arm, they
+		// shadow the variables of the same name around the match
+		c.symTable.EnterBlock()
+		failJumps, err := c.compileMatchArm(arm, subject)
+		c.symTable.LeaveBlock()
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 42069))
+
+		nextArmPos := len(c.currentInstructions())
+		for _, pos := range failJumps {
+			c.changeOperand(pos, nextArmPos)
+		}
+	}
+	// no arm matched
+	c.emit(code.OpNull)
+
+	afterMatchPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterMatchPos)
+	}
+	return nil
+}
+
+// compileMatchArm compiles the pattern, guard and body of arm and
+// returns the positions of the jumps taken when the arm doesn't match
+func (c *Compiler) compileMatchArm(arm *ast.MatchArm, subject Symbol) ([]int, error) {
+	failJumps, err := c.compileMatchPattern(arm.Pattern, subject)
+	if err != nil {
+		return nil, err
+	}
+	if arm.Guard != nil {
+		err := c.Compile(arm.Guard)
+		if err != nil {
+			return nil, err
+		}
+		failJumps = append(failJumps, c.emit(code.OpJumpNotTruthy, 42069))
+	}
+	return failJumps, c.Compile(arm.Body)
+}
+
+// compileMatchPattern tests the value of sym against pattern and binds
+// its identifiers. It returns the positions of the jumps taken when a
+// test fails. The parts of arrays and hashes are tested from slots of
+// their own, so the stack is left as it was on either path.
+func (c *Compiler) compileMatchPattern(pattern ast.Pattern, sym Symbol) ([]int, error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			c.loadSymbol(sym)
+			c.storeSymbol(c.symTable.DefineHidden(pattern.Value))
+		}
+		return nil, nil
+	case *ast.LiteralPattern:
+		c.loadSymbol(sym)
+		err := c.Compile(pattern.Value)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(code.OpMatchEqual)
+		return []int{c.emit(code.OpJumpNotTruthy, 42069)}, nil
+	case *ast.ArrayPattern:
+		hasRest := 0
+		if pattern.Rest != nil {
+			hasRest = 1
+		}
+		c.loadSymbol(sym)
+		c.emit(code.OpMatchArray, len(pattern.Elements), hasRest)
+		failJumps := []int{c.emit(code.OpJumpNotTruthy, 42069)}
+
+		c.loadSymbol(sym)
+		c.emit(code.OpUnpackArray, len(pattern.Elements), hasRest)
+		return c.compileMatchParts(pattern.Elements, pattern.Rest, failJumps)
+	case *ast.HashPattern:
+		c.loadSymbol(sym)
+		c.emitMatchKeys(pattern.Keys)
+		c.emit(code.OpMatchHash, len(pattern.Keys))
+		failJumps := []int{c.emit(code.OpJumpNotTruthy, 42069)}
+
+		c.loadSymbol(sym)
+		c.emitMatchKeys(pattern.Keys)
+		c.emit(code.OpUnpackHash, len(pattern.Keys))
+		return c.compileMatchParts(pattern.Values, nil, failJumps)
+	}
+	return nil, fmt.Errorf("%s: unknown pattern %s", pattern.Pos(), pattern)
+}
+
+// compileMatchParts stores the unpacked parts of an array or hash on
+// the stack and matches each against its pattern
+func (c *Compiler) compileMatchParts(patterns []ast.Pattern, rest *ast.Identifier, failJumps []int) ([]int, error) {
+	parts := make([]Symbol, len(patterns))
+	for i := range patterns {
+		parts[i] = c.symTable.DefineHidden("$match")
+		c.storeSymbol(parts[i])
+	}
+	if rest != nil {
+		if rest.Value == "_" {
+			c.emit(code.OpPop)
+		} else {
+			c.storeSymbol(c.symTable.DefineHidden(rest.Value))
+		}
+	}
+	for i, part := range patterns {
+		jumps, err := c.compileMatchPattern(part, parts[i])
+		if err != nil {
+			return nil, err
+		}
+		failJumps = append(failJumps, jumps...)
+	}
+	return failJumps, nil
+}
+
+func (c *Compiler) emitMatchKeys(keys []*ast.Identifier) {
+	for _, key := range keys {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: key.Value}))
+	}
+}
+
+// loadCell loads a variable captured by a closure. Locals and free
+// variables are loaded as cells, so assignments to them are shared.
+func (c *Compiler) loadCell(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		sym, ok := c.symTable.Resolve(target.Value)
+		if !ok {
+			return fmt.Errorf("%s: undefined variable %s", target.Pos(), target.Value)
+		}
+		if sym.Scope != GlobalScope && sym.Scope != LocalScope && sym.Scope != FreeScope {
+			return fmt.Errorf("%s: cannot assign to %s", target.Pos(), target.Value)
+		}
+		if sym.Const {
+			return fmt.Errorf("%s: cannot assign to constant %s, declared at %s", target.Pos(), target.Value, sym.Declared)
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(sym)
+		c.loadSymbol(sym)
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+	default:
+		return fmt.Errorf("%s: cannot assign to %s", node.Pos(), node.Target)
+	}
+	return nil
+}
+
+// compileTryExpression compiles the try block under a handler that
+// jumps to the catch block, which gets the exception on the stack. With
+// a finally block the catch block runs under a handler of its own, that
+// runs the finally block and throws the exception on. The handlers of
+// finally blocks are set up with OpTryFinally, they get the exception
+// along with the position it was raised at.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	op := code.OpTry
+	if node.Catch == nil {
+		op = code.OpTryFinally
+	}
+	tryPos := c.emit(op, 42069)
+	err := c.compileTryBlock(node.Block, node.Finally)
+	if err != nil {
+		return err
+	}
+	doneJumps := []int{c.emit(code.OpJump, 42069)}
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	if node.Catch != nil {
+		// the parameter only exists within the catch block
+		c.symTable.EnterBlock()
+		catchJumps, err := c.compileCatch(node)
+		c.symTable.LeaveBlock()
+		if err != nil {
+			return err
+		}
+		doneJumps = append(doneJumps, catchJumps...)
+	}
+	if node.Finally != nil {
+		err := c.Compile(node.Finally)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	}
+
+	donePos := len(c.currentInstructions())
+	for _, pos := range doneJumps {
+		c.changeOperand(pos, donePos)
+	}
+	if node.Finally != nil {
+		return c.Compile(node.Finally)
+	}
+	return nil
+}
+
+// compileCatch compiles the catch block of node, with the exception on
+// the stack bound to its parameter, and returns the jump to the end of
+// the try expression
+func (c *Compiler) compileCatch(node *ast.TryExpression) ([]int, error) {
+	if node.Param != nil {
+		c.storeSymbol(c.symTable.DefineHidden(node.Param.Value))
+	} else {
+		c.emit(code.OpPop)
+	}
+	if node.Finally == nil {
+		err := c.compileBlockValue(node.Catch)
+		if err != nil {
+			return nil, err
+		}
+		return []int{c.emit(code.OpJump, 42069)}, nil
+	}
+	catchPos := c.emit(code.OpTryFinally, 42069)
+	err := c.compileTryBlock(node.Catch, node.Finally)
+	if err != nil {
+		return nil, err
+	}
+	doneJump := c.emit(code.OpJump, 42069)
+	c.changeOperand(catchPos, len(c.currentInstructions()))
+	return []int{doneJump}, nil
+}
+
+// compileTryBlock compiles the value of block under the handler of the
+// OpTry just emitted and ends the handler after it
+func (c *Compiler) compileTryBlock(block, finally *ast.BlockStatement) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, &Try{finally: finally})
+
+	err := c.compileBlockValue(block)
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	return nil
+}
+
+// compileBlockValue compiles a block that evaluates to its last
+// expression statement, or to null if it doesn't end in one
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+	var last ast.Statement
+	if n := len(block.Statements); n > 0 {
+		last = block.Statements[n-1]
+	}
+	if _, ok := last.(*ast.ExpressionStatement); ok {
+		c.removeLastInstruction()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// leaveTries ends the handlers of the tries control jumps out of, down
+// to the first n, and runs their finally blocks on the way
+func (c *Compiler) leaveTries(n int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= n; i-- {
+		// a finally block is not part of the try it belongs to
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		c.emit(code.OpEndTry)
+		if tries[i].finally != nil {
+			err := c.Compile(tries[i].finally)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) enterLoop(continuePos int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &Loop{continuePos: continuePos, tries: len(scope.tries)})
+}
+
+// leaveLoop patches the break jumps of the current loop to endPos
+func (c *Compiler) leaveLoop(endPos int) {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	for _, pos := range loop.breakJumps {
+		c.changeOperand(pos, endPos)
+	}
+}
+
+func (c *Compiler) currentLoop() *Loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
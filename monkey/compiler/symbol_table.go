@@ -1,5 +1,7 @@
 package compiler
 
+import "monkey/token"
+
 type SymbolScope string
 
 const (
@@ -14,6 +16,10 @@ type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	// Const is set for symbols defined by a const statement at Declared,
+	// the compiler refuses to assign to them
+	Const    bool
+	Declared token.Position
 }
 
 type SymbolTable struct {
@@ -21,6 +27,19 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+	block          *blockScope
+}
+
+// blockScope records what the names defined in a block scope stood for
+// before it, so they can be restored when the block is left
+type blockScope struct {
+	outer    *blockScope
+	previous map[string]blockSymbol
+}
+
+type blockSymbol struct {
+	symbol  Symbol
+	defined bool
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -36,17 +55,77 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 }
 
 func (s *SymbolTable) Define(name string) Symbol {
+	// defining a name again rebinds it, code compiled before the new
+	// definition has to see the new value too
+	if symbol, ok := s.Local(name); ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		symbol.Const = false
+		symbol.Declared = token.Position{}
+		s.store[name] = symbol
+		return symbol
+	}
+	return s.DefineHidden(name)
+}
+
+// DefineHidden defines name in a slot of its own even if name is defined
+// already, for values the compiler keeps out of sight of the program
+func (s *SymbolTable) DefineHidden(name string) Symbol {
 	symbol := Symbol{Name: name, Scope: GlobalScope, Index: s.numDefinitions}
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
 	} else {
 		symbol.Scope = LocalScope
 	}
+	if s.block != nil {
+		if _, ok := s.block.previous[name]; !ok {
+			previous, defined := s.store[name]
+			s.block.previous[name] = blockSymbol{symbol: previous, defined: defined}
+		}
+	}
 	s.store[name] = symbol
 	s.numDefinitions += 1
 	return symbol
 }
 
+// Local returns the symbol name is defined as in the innermost scope,
+// names defined around a block scope don't count within it
+func (s *SymbolTable) Local(name string) (Symbol, bool) {
+	if s.block != nil {
+		if _, ok := s.block.previous[name]; !ok {
+			return Symbol{}, false
+		}
+	}
+	symbol, ok := s.store[name]
+	return symbol, ok
+}
+
+// EnterBlock starts a block scope, names defined in it get slots of
+// their own and shadow the names around it until LeaveBlock
+func (s *SymbolTable) EnterBlock() {
+	s.block = &blockScope{outer: s.block, previous: make(map[string]blockSymbol)}
+}
+
+// LeaveBlock ends the innermost block scope and restores the names
+// defined in it
+func (s *SymbolTable) LeaveBlock() {
+	for name, previous := range s.block.previous {
+		if previous.defined {
+			s.store[name] = previous.symbol
+		} else {
+			delete(s.store, name)
+		}
+	}
+	s.block = s.block.outer
+}
+
+// DefineConst defines name like Define, as a constant declared at pos
+func (s *SymbolTable) DefineConst(name string, pos token.Position) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	symbol.Declared = pos
+	s.store[name] = symbol
+	return symbol
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	sym := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = sym
@@ -78,7 +157,13 @@ func (s *SymbolTable) Resolve(name string) (sym Symbol, ok bool) {
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
 
-	sym := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	sym := Symbol{
+		Name:     original.Name,
+		Index:    len(s.FreeSymbols) - 1,
+		Scope:    FreeScope,
+		Const:    original.Const,
+		Declared: original.Declared,
+	}
 	s.store[original.Name] = sym
 
 	return sym
@@ -1,6 +1,35 @@
 package compiler
 
-import "testing"
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestDefineConst(t *testing.T) {
+	pos := token.Position{Line: 1, Column: 7}
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	nested := NewEnclosedSymbolTable(local)
+
+	a := global.DefineConst("a", pos)
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 0, Const: true, Declared: pos}
+	if a != expected {
+		t.Errorf("expected a=%+v, got %+v", expected, a)
+	}
+	if b := global.Define("b"); b.Index != 1 || b.Const {
+		t.Errorf("b should be a mutable symbol at index 1. got %+v", b)
+	}
+
+	local.DefineConst("c", pos)
+	c, ok := nested.Resolve("c")
+	if !ok {
+		t.Fatalf("name c not resolvable")
+	}
+	expected = Symbol{Name: "c", Scope: FreeScope, Index: 0, Const: true, Declared: pos}
+	if c != expected {
+		t.Errorf("expected c=%+v, got %+v", expected, c)
+	}
+}
 
 func TestDefine(t *testing.T) {
 	expected := map[string]Symbol{
@@ -43,6 +72,50 @@ func TestDefine(t *testing.T) {
 	}
 }
 
+func TestDefineAgain(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	global.Define("a")
+	global.Define("b")
+	if a := global.Define("a"); a.Index != 0 {
+		t.Errorf("defining a again should reuse index 0. got %+v", a)
+	}
+	if hidden := global.DefineHidden("a"); hidden.Index != 2 {
+		t.Errorf("hidden a should get index 2. got %+v", hidden)
+	}
+
+	local.Define("c")
+	if c := local.Define("c"); c.Index != 0 || c.Scope != LocalScope {
+		t.Errorf("defining c again should reuse local index 0. got %+v", c)
+	}
+	if a := local.Define("a"); a.Index != 1 || a.Scope != LocalScope {
+		t.Errorf("a should shadow the global a at local index 1. got %+v", a)
+	}
+}
+
+func TestBlockScope(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+
+	global.EnterBlock()
+	if inner := global.Define("a"); inner.Index != 1 {
+		t.Errorf("a in the block should shadow the outer a at index 1. got %+v", inner)
+	}
+	if again := global.Define("a"); again.Index != 1 {
+		t.Errorf("defining a again in the block should reuse index 1. got %+v", again)
+	}
+	global.Define("b")
+	global.LeaveBlock()
+
+	if outer, ok := global.Resolve("a"); !ok || outer != a {
+		t.Errorf("a should resolve to %+v after the block. got %+v", a, outer)
+	}
+	if b, ok := global.Resolve("b"); ok {
+		t.Errorf("b should not resolve after the block. got %+v", b)
+	}
+}
+
 func TestResolveGlobal(t *testing.T) {
 	expected := []Symbol{
 		{Name: "a", Scope: GlobalScope, Index: 0},
@@ -13,4 +13,5 @@ var builtins = map[string]*object.Builtin{
 	"print": object.GetBuildinByName("print"),
 	"exit":  object.GetBuildinByName("exit"),
 	"quit":  object.GetBuildinByName("exit"),
+	"error": object.GetBuildinByName("error"),
 }
@@ -2,6 +2,7 @@ package eval
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/object"
 )
@@ -10,25 +11,72 @@ var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := evalNode(node, env)
+	// the innermost node that produced an error is the one to blame
+	if err, ok := result.(*object.Error); ok && !err.Caught && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
 		return evalProgram(node, env)
+	case *ast.BadStatement, *ast.BadExpression:
+		return newError("cannot evaluate invalid syntax")
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil {
+			return bindPattern(node.Pattern, val, env)
+		}
+		if node.IsConst() {
+			if _, err := env.SetConst(node.Name.Value, val, node.Name.Pos()); err != nil {
+				errObj := newError("%s", err)
+				errObj.Pos = node.Name.Pos()
+				return errObj
+			}
+		} else if err := define(node.Name, val, env); err != nil {
+			return err
+		}
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.ExportStatement:
+		return Eval(node.Let, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return throw(val)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -41,12 +89,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIdentifier(node, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return booleanObject(node.Value)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -58,15 +110,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env.CheckedArithmetic)
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Env:        env,
+			Body:       node.Body,
+		}
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
 			return quote(node.Arguments[0], env)
@@ -80,6 +139,27 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 		return applyFunction(function, args)
+	case *ast.MethodCallExpression:
+		receiver := Eval(node.Receiver, env)
+		if isError(receiver) {
+			return receiver
+		}
+		method, ok := object.GetMember(receiver, node.Method.Value)
+		if !ok {
+			return newError("undefined method %s for %s", node.Method.Value, receiver.Type())
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(method, args)
+	case *ast.PropagateExpression:
+		val := Eval(node.Value, env)
+		// a raised error propagates by itself, ? returns error values
+		if err, ok := val.(*object.Error); ok && err.Caught {
+			return &object.ReturnValue{Value: err}
+		}
+		return val
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -90,6 +170,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
 	case *ast.ArrayLiteral:
 		elems := evalExpressions(node.Elements, env)
 		if len(elems) == 1 && isError(elems[0]) {
@@ -108,7 +190,9 @@ func evalProgram(program *ast.Program, env *object.Environment) (result object.O
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
-			return result
+			if !result.Caught {
+				return result
+			}
 		}
 	}
 	return
@@ -119,8 +203,13 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) (res
 		result = Eval(statement, env)
 
 		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
 				return
+			case object.ERROR_OBJ:
+				if isError(result) {
+					return
+				}
 			}
 		}
 	}
@@ -133,15 +222,22 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		if right, ok := right.(*object.Integer); ok {
+			return &object.Integer{Value: ^right.Value}
+		}
+		return newError("unknown operator: ~%s", right.Type())
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(operator string, left, right object.Object, checked bool) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, checked)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -169,17 +265,30 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+func evalIntegerInfixExpression(operator string, left, right object.Object, checked bool) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	if rightVal == 0 && operator == "/" {
+		return newError("division by zero: %d / 0", leftVal)
+	}
+	if rightVal == 0 && operator == "%" {
+		return newError("modulo by zero: %d %% 0", leftVal)
+	}
+	if checked && object.IntegerOverflows(operator, leftVal, rightVal) {
+		return newError("integer overflow: %d %s %d", leftVal, operator, rightVal)
+	}
+
 	switch operator {
 	case "+":
 		return &object.Integer{Value: leftVal + rightVal}
@@ -189,10 +298,71 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		return &object.Integer{Value: object.IntMod(leftVal, rightVal)}
+	case "**":
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		return &object.Integer{Value: object.IntPow(leftVal, rightVal)}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	case "<":
 		return booleanObject(leftVal < rightVal)
 	case ">":
 		return booleanObject(leftVal > rightVal)
+	case "<=":
+		return booleanObject(leftVal <= rightVal)
+	case ">=":
+		return booleanObject(leftVal >= rightVal)
+	case "==":
+		return booleanObject(leftVal == rightVal)
+	case "!=":
+		return booleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression handles mixed integer and float operands,
+// integers are promoted to floats
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return booleanObject(leftVal < rightVal)
+	case ">":
+		return booleanObject(leftVal > rightVal)
+	case "<=":
+		return booleanObject(leftVal <= rightVal)
+	case ">=":
+		return booleanObject(leftVal >= rightVal)
 	case "==":
 		return booleanObject(leftVal == rightVal)
 	case "!=":
@@ -217,6 +387,61 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	}
 }
 
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+		if result, done := evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+func evalForInStatement(fs *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	iter, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+	for el, ok := iter.Next(); ok; el, ok = iter.Next() {
+		if err := define(fs.Variable, el, env); err != nil {
+			return err
+		}
+		if result, done := evalLoopBody(fs.Body, env); done {
+			return result
+		}
+	}
+	return NULL
+}
+
+// evalLoopBody runs a single iteration of a loop body and reports
+// whether the loop is done, and if so what it evaluates to
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+	if result == nil {
+		return NULL, false
+	}
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return NULL, true
+	case object.RETURN_VALUE_OBJ:
+		return result, true
+	case object.ERROR_OBJ:
+		if isError(result) {
+			return result, true
+		}
+	}
+	return NULL, false
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 	if isError(condition) {
@@ -230,6 +455,56 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	return NULL
 }
 
+// evalTryExpression evaluates the catch block if the try block throws,
+// the finally block runs in any case. A finally block that doesn't
+// complete normally overrides the result of the others.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+	if err, ok := result.(*object.Error); ok && isError(err) && te.Catch != nil {
+		// the parameter only exists within the catch block
+		catchEnv := object.NewInnerEnv(env)
+		if te.Param != nil {
+			catchEnv.Set(te.Param.Value, caught(err))
+		}
+		result = Eval(te.Catch, catchEnv)
+	}
+	if te.Finally != nil {
+		final := Eval(te.Finally, env)
+		if final != nil {
+			switch final.Type() {
+			case object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return final
+			case object.ERROR_OBJ:
+				if isError(final) {
+					return final
+				}
+			}
+		}
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// throw raises val, runtime errors raised this way keep their message
+func throw(val object.Object) *object.Error {
+	message := val.Inspect()
+	if err, ok := val.(*object.Error); ok {
+		message = err.Message
+	}
+	return &object.Error{Message: message, Value: val}
+}
+
+// caught returns the value a catch block gets for err, that is the
+// value thrown or the runtime error itself
+func caught(err *object.Error) object.Object {
+	if err.Value != nil {
+		return err.Value
+	}
+	return &object.Error{Message: err.Message, Pos: err.Pos, Caught: true}
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
@@ -241,8 +516,201 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: " + node.Value)
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if _, err := env.Assign(target.Value, val); err != nil {
+			return newError("%s", err)
+		}
+		return val
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return evalIndexAssignment(left, index, val)
+	default:
+		return newError("cannot assign to %s", node.Target)
+	}
+}
+
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		arrayObj := left.(*object.Array)
+		idx := index.(*object.Integer).Value
+		if idx < 0 || idx >= int64(len(arrayObj.Elements)) {
+			return newError("index out of range: %d", idx)
+		}
+		arrayObj.Elements[idx] = val
+		return val
+	case left.Type() == object.HASH_OBJ:
+		hashObj := left.(*object.Hash)
+		if hashObj.Exports {
+			return newError("cannot assign to export %s", index.Inspect())
+		}
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		hashObj.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+		return val
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+// bindPattern destructures val into the identifiers of pattern, it
+// returns an error if val does not have the shape of the pattern
+func bindPattern(pattern ast.Pattern, val object.Object, env *object.Environment) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if err := define(pattern, val, env); err != nil {
+			return err
+		}
+	case *ast.ArrayPattern:
+		array, ok := val.(*object.Array)
+		if !ok {
+			return newError("cannot destructure %s as ARRAY", val.Type())
+		}
+		n := len(pattern.Elements)
+		if pattern.Rest == nil && len(array.Elements) != n {
+			return newError("array pattern expects %d elements, got %d", n, len(array.Elements))
+		}
+		if len(array.Elements) < n {
+			return newError("array pattern expects at least %d elements, got %d", n, len(array.Elements))
+		}
+		for i, el := range pattern.Elements {
+			if err := bindPattern(el, array.Elements[i], env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := make([]object.Object, len(array.Elements)-n)
+			copy(rest, array.Elements[n:])
+			return bindPattern(pattern.Rest, &object.Array{Elements: rest}, env)
+		}
+	case *ast.HashPattern:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return newError("cannot destructure %s as HASH", val.Type())
+		}
+		for i, key := range pattern.Keys {
+			hashKey := (&object.String{Value: key.Value}).HashKey()
+			pair, ok := hash.Pairs[hashKey]
+			if !ok {
+				return newError("hash pattern key %q not found", key.Value)
+			}
+			if err := bindPattern(pattern.Values[i], pair.Value, env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	for _, arm := range me.Arms {
+		// the variables of an arm only exist within the arm, they
+		// shadow the variables of the same name around the match
+		armEnv := object.NewInnerEnv(env)
+		if !matchPattern(arm.Pattern, subject, armEnv) {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, armEnv)
+	}
+	return NULL
+}
+
+// matchPattern reports whether val matches pattern, binding the
+// identifiers in pattern in env as it goes
+func matchPattern(pattern ast.Pattern, val object.Object, env *object.Environment) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(pattern.Value, val)
+		}
+		return true
+	case *ast.LiteralPattern:
+		return object.Equal(Eval(pattern.Value, env), val)
+	case *ast.ArrayPattern:
+		array, ok := val.(*object.Array)
+		if !ok {
+			return false
+		}
+		n := len(pattern.Elements)
+		if len(array.Elements) < n || pattern.Rest == nil && len(array.Elements) != n {
+			return false
+		}
+		for i, el := range pattern.Elements {
+			if !matchPattern(el, array.Elements[i], env) {
+				return false
+			}
+		}
+		if pattern.Rest != nil {
+			rest := make([]object.Object, len(array.Elements)-n)
+			copy(rest, array.Elements[n:])
+			matchPattern(pattern.Rest, &object.Array{Elements: rest}, env)
+		}
+		return true
+	case *ast.HashPattern:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return false
+		}
+		for i, key := range pattern.Keys {
+			hashKey := (&object.String{Value: key.Value}).HashKey()
+			pair, ok := hash.Pairs[hashKey]
+			if !ok || !matchPattern(pattern.Values[i], pair.Value, env) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func evalExpressions(exps []ast.Expression, env *object.Environment) (result []object.Object) {
 	for _, exp := range exps {
+		if spread, ok := exp.(*ast.SpreadExpression); ok {
+			evalulated := Eval(spread.Value, env)
+			if isError(evalulated) {
+				return []object.Object{evalulated}
+			}
+			array, ok := evalulated.(*object.Array)
+			if !ok {
+				err := newError("cannot spread %s", evalulated.Type())
+				err.Pos = spread.Pos()
+				return []object.Object{err}
+			}
+			result = append(result, array.Elements...)
+			continue
+		}
 		evalulated := Eval(exp, env)
 		if isError(evalulated) {
 			return []object.Object{evalulated}
@@ -263,6 +731,28 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+func evalSliceExpression(se *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(se.Left, env)
+	if isError(left) {
+		return left
+	}
+	bounds := []object.Object{NULL, NULL}
+	for i, bound := range []ast.Expression{se.Low, se.High} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+	slice, err := object.Slice(left, bounds[0], bounds[1])
+	if err != nil {
+		return newError("%s", err)
+	}
+	return slice
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -281,7 +771,9 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObj.Pairs[key.HashKey()]
-	if !ok {
+	if !ok && hashObj.Exports {
+		return newError("undefined export %s", index.Inspect())
+	} else if !ok {
 		return NULL
 	}
 	return pair.Value
@@ -313,10 +805,14 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		if len(args) != len(fn.Parameters) {
-			return newError("invalid parameter count. expected %d. got %d", len(fn.Parameters), len(args))
+		min, max := fn.Arity()
+		if len(args) < min || max != -1 && len(args) > max {
+			return newError("invalid parameter count. expected %s. got %d", object.FormatArity(min, max), len(args))
+		}
+		newEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
 		}
-		newEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, newEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
@@ -330,12 +826,30 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendFunctionEnv binds the parameters of fn to args. Default values
+// of missing arguments are evaluated in the new environment, so they
+// can refer to the parameters before them.
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
 	env := object.NewInnerEnv(fn.Env)
 	for i, param := range fn.Parameters {
-		env.Set(param.Value, args[i])
+		if i < len(args) {
+			env.Set(param.Value, args[i])
+			continue
+		}
+		val := Eval(fn.Defaults[i], env)
+		if err, ok := val.(*object.Error); ok && !err.Caught {
+			return nil, err
+		}
+		env.Set(param.Value, val)
 	}
-	return env
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+	return env, nil
 }
 
 func unwrapReturnValue(retObj object.Object) object.Object {
@@ -345,6 +859,34 @@ func unwrapReturnValue(retObj object.Object) object.Object {
 	return retObj
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+// evalLogicalExpression only evaluates the right operand of && and ||
+// if the left one does not decide the result already
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if isTruthy(left) == (node.Operator == "||") {
+		return booleanObject(isTruthy(left))
+	}
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return booleanObject(isTruthy(right))
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -369,9 +911,28 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// define binds ident in env, where a constant of that name cannot be
+// defined again
+func define(ident *ast.Identifier, val object.Object, env *object.Environment) *object.Error {
+	if _, err := env.Set(ident.Value, val); err != nil {
+		errObj := newError("%s", err)
+		errObj.Pos = ident.Pos()
+		return errObj
+	}
+	return nil
+}
+
+// isError reports whether obj cuts the evaluation short, that is if it
+// is an error that wasn't caught. Errors that were caught are ordinary
+// values. A return value, which ? returns from within an expression,
+// cuts it short as well, and so do break and continue from a block
+// within an expression.
 func isError(obj object.Object) bool {
-	if obj == nil {
-		return false
+	switch obj := obj.(type) {
+	case *object.Error:
+		return !obj.Caught
+	case *object.ReturnValue, *object.Break, *object.Continue:
+		return true
 	}
-	return obj.Type() == object.ERROR_OBJ
+	return false
 }
@@ -2,8 +2,12 @@ package eval
 
 import (
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +31,26 @@ func TestIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"2 * 3 ** 2", 18},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 << 64", 0},
+		{"1 + 2 << 3", 24},
+		{"1 | 2 ^ 3 & 4", 3},
+		{"0xFF + 0o10 + 0b11", 266},
+		{"1_000 * 2", 2000},
 	}
 
 	for _, test := range tests {
@@ -35,6 +59,43 @@ func TestIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"1e-3", 0.001},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"7.5 % 2", 1.5},
+		{"-7.5 % 2", -1.5},
+		{"2 ** -1", 0.5},
+		{"2.0 ** 3", 8.0},
+		{"9 ** 0.5", 3.0},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -46,6 +107,13 @@ func TestBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 2", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"1 >= 1", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -80,6 +148,19 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestStringEscapes(t *testing.T) {
+	input := `"line\n\t\"quoted\" \u{2713}"`
+	expected := "line\n\t\"quoted\" \u2713"
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got %T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != expected {
+		t.Errorf("String value was not %q. got %q", expected, str.Value)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " +  "World!";`
 	expected := "Hello World!"
@@ -111,6 +192,30 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"if (false) { 1 } || 1", true},
+		{"if (false) { 1 } || false", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"false && 1 + true", false},
+		{"true || 1 + true", true},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		testBooleanObject(t, evaluated, test.expected)
+	}
+}
+
 func TestIfElseExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -153,6 +258,206 @@ func TestReturnStatement(t *testing.T) {
 	}
 }
 
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { let i = i + 1; } i", 5},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } } i", 3},
+		{"let i = 0; let n = 0; while (i < 5) { let i = i + 1; if (i % 2 == 0) { continue; } let n = n + i; } n", 9},
+		{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; } sum", 6},
+		{"let f = fn() { for (x in [1, 2, 3, 4]) { if (x > 2) { return x; } } }; f()", 3},
+		{"let f = fn() { for (x in [1, 2]) { for (y in [3, 4, 5]) { if (y == 4) { break; } } } x * 10 + y }; f()", 24},
+		{"let s = \"\"; for (c in \"héllo\") { let s = c + s; } s", "olléh"},
+		{"let s = \"\"; for (k in {\"b\": 1, \"a\": 2, \"c\": 3}) { let s = s + k; } s", "abc"},
+		{"let n = 0; for (k in {2: 1, -1: 2, 1: 3}) { let n = n * 10 + k; } n", -88},
+		{"while (false) { 1 }", nil},
+		{"let f = fn() { for (x in []) { return 1; } }; f()", nil},
+		{"let n = 0; while (true) { n = n + 1; if (n == 2) { break; } else { 0 } + 1; } n", 2},
+		{"let i = 0; while (i < 3000) { i = i + 1; if (true) { continue; } + 1; } i", 3000},
+		{"let n = 0; while (true) { n = n + 1; let y = [1, if (true) { while (true) { break; } 5 }]; if (n == 2) { break; } } n", 2},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = x + 1; x", 2},
+		{"let x = 1; x = 5", 5},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let x = 1; let f = fn() { x = 10; }; f(); x", 10},
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let f = fn(x) { let g = fn() { x = x * 2 }; g(); g(); x }; f(3)", 12},
+		{"let f = fn() { let n = 0; let g = fn() { let h = fn() { n = n + 1 }; h(); h() }; g(); n }; f()", 2},
+		{"let mk = fn(v) { let x = v; fn() { x } }; let a = mk(1); let b = mk(2); a() + b() * 10", 21},
+		{"let a = [1, 2, 3]; a[1] = 5; a[0] + a[1] + a[2]", 9},
+		{"let h = {}; h[\"k\"] = 2; h[\"k\"] * 3", 6},
+		{"let a = [1, 2]; let b = a; b[0] = 7; a[0]", 7},
+		{"let i = 0; let sum = 0; while (i < 5) { i = i + 1; sum = sum + i; } sum", 15},
+		{"const x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+		{"const a = [1]; a[0] = 2; a[0]", 2},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(test.input), test.expected)
+	}
+}
+
+func TestPipeOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let double = fn(x) { x * 2 }; 3 |> double", 6},
+		{"let add = fn(a, b) { a + b }; 1 |> add(2) |> add(3)", 6},
+		{"[1, 2, 3] |> push(4) |> len", 4},
+		{"[1, 2, 3] |> tail |> head", 2},
+		{"2 |> fn(x) { x * x }", 4},
+		{"1 + 2 |> fn(x) { x * 10 }", 30},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(test.input), test.expected)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let [first, ...rest] = [1, 2, 3]; first + len(rest) * 10", 21},
+		{"let [...all] = []; len(all)", 0},
+		{"let {name, age} = {\"name\": \"x\", \"age\": 3}; age", 3},
+		{"let {pos: [x, y]} = {\"pos\": [4, 5]}; x * y", 20},
+		{"let f = fn([a, b], {c}) { a + b + c }; f([1, 2], {\"c\": 3})", 6},
+		{"let f = fn(x) { let [a, ...b] = x; fn() { a + len(b) } }; f([5, 6, 7])()", 7},
+		{"let [a, b] = [1, 2]; let [a, b] = [b, a]; a * 10 + b", 21},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(test.input), test.expected)
+	}
+}
+
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1, 2]; let b = [4]; let c = [...a, 3, ...b]; len(c) * 10 + c[2]", 43},
+		{"len([...[], ...[]])", 0},
+		{"let a = [1, 2]; let b = [...a]; b[0] = 5; a[0]", 1},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)", 6},
+		{"let f = fn(...xs) { len(xs) }; let g = fn(...xs) { f(0, ...xs) }; g(1, 2)", 3},
+		{"let f = fn(a, b = 10) { a + b }; f(...[1])", 11},
+		{"len(...[[1, 2, 3]])", 3},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(test.input), test.expected)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"match (1) { 1 => 10, _ => 20 }", 10},
+		{"match (2) { 1 => 10, _ => 20 }", 20},
+		{"match (-1) { -1 => 1, _ => 2 }", 1},
+		{"match (\"b\") { \"a\" => 1, \"b\" => 2, _ => 3 }", 2},
+		{"match (1) { true => 1, 1.0 => 2, 1 => 3, _ => 4 }", 2},
+		{"match (5) { n => n * 2 }", 10},
+		{"match ([1, 2]) { [a] => a, [a, b] => a + b, _ => 0 }", 3},
+		{"match ([1, 2, 3]) { [1, ...rest] => len(rest), _ => 0 }", 2},
+		{"match ([1, 2, 3]) { [2, ...rest] => len(rest), [_, x, _] => x }", 2},
+		{"match ([]) { [_, ..._] => 1, [] => 2 }", 2},
+		{"match ({\"kind\": \"click\", \"pos\": [3, 4]}) { {kind: \"key\"} => 0, {kind: \"click\", pos: [x, y]} => x * y, _ => -1 }", 12},
+		{"match ({\"a\": 1}) { {b} => b, {a} => a }", 1},
+		{"match (\"a\") { [x] => x, {x} => x, x => 9 }", 9},
+		{"match (7) { n if n < 5 => 1, n if n < 10 => 2, _ => 3 }", 2},
+		{"let f = fn(x) { match (x) { [h, ...t] => h + f(t), [] => 0 } }; f([1, 2, 3, 4])", 10},
+		{"let f = fn(v) { match (v) { [a, b] => match (a) { 1 => b, _ => a }, _ => 0 } }; f([1, 5]) + f([2, 5])", 7},
+		{"match (3) { x => fn() { x } }()", 3},
+		{"let a = 100; match ([1, 2]) { [a, 5] => a, _ => a }", 100},
+		{"let a = 100; match ([1, 2]) { [a, 5] => a, _ => 0 }; a", 100},
+		{"let a = 100; match (7) { a if a < 5 => 1, _ => 2 }; a", 100},
+		{"let f = fn() { let a = 100; match ([1, [2]]) { [a, [3]] => 0, [_, [b]] => a + b } }; f()", 102},
+		{"let a = 1; match ([5, 6]) { [a, b] => 0 }; a", 1},
+		{"let x = 5; let y = match (3) { x => x * 2 }; x + y", 11},
+		{"const x = 1; match (2) { x => x }", 2},
+		{"let a = 1; match (2) { x => if (true) { let a = x; a } }; a", 1},
+		{"match (4) { a if a > 2 => a, _ => 0 }", 4},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(test.input), test.expected)
+	}
+
+	testNullObject(t, testEval("match (3) { 1 => 1, 2 => 2 }"))
+
+	str, ok := testEval(`match (1.0) { 1 => "int", _ => "other" }`).(*object.String)
+	if !ok || str.Value != "int" {
+		t.Errorf("literal pattern 1 did not match 1.0. got %v", str)
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1)", 3},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1, 5)", 6},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1, 5, 7)", 7},
+		{"let f = fn(...xs) { len(xs) }; f()", 0},
+		{"let f = fn(...xs) { len(xs) }; f(1, 2, 3)", 3},
+		{"let f = fn(a, ...xs) { a + len(xs) }; f(1, 2, 3)", 3},
+		{"let f = fn(a = 1, ...xs) { a * 10 + len(xs) }; f()", 10},
+		{"let f = fn(a = 1, ...xs) { a * 10 + len(xs) }; f(2)", 20},
+		{"let f = fn(a = 1, ...xs) { a * 10 + len(xs) }; f(2, 3, 4)", 22},
+		{"let f = fn(a, ...xs) { fn() { xs[0] } }; f(1, 7)()", 7},
+		{"let n = 1; let f = fn(a = n) { a }; n = 5; f()", 5},
+		{"let f = fn([a, b] = [1, 2]) { a + b }; f()", 3},
+		{"let make = fn(x) { fn(y = x) { y } }; make(4)()", 4},
+		{"let f = fn(a = 1) { let b = 2; a + b }; f() + f(3)", 8},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(test.input), test.expected)
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -170,6 +475,114 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"for (x in 1) { x }",
+			"cannot iterate over INTEGER",
+		},
+		{
+			"x = 1",
+			"identifier not found: x",
+		},
+		{
+			`throw "boom"`,
+			"boom",
+		},
+		{
+			"try { throw {} } finally { 1 }",
+			"{}",
+		},
+		{
+			"try { 1 } finally { -true }",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"const x = 1; x = 2",
+			"cannot assign to constant x, declared at 1:7",
+		},
+		{
+			"const n = 0; let inc = fn() { n = n + 1 }; inc()",
+			"cannot assign to constant n, declared at 1:7",
+		},
+		{
+			"const a = 1; let a = 2; a",
+			"cannot assign to constant a, declared at 1:7",
+		},
+		{
+			"const a = 1; const a = 2; a",
+			"cannot assign to constant a, declared at 1:7",
+		},
+		{
+			"const a = 1; let [a] = [9]; a",
+			"cannot assign to constant a, declared at 1:7",
+		},
+		{
+			"const a = 1; for (a in [5, 6]) { } a",
+			"cannot assign to constant a, declared at 1:7",
+		},
+		{
+			"let a = [1]; a[5] = 2",
+			"index out of range: 5",
+		},
+		{
+			"1[0] = 2",
+			"index assignment not supported: INTEGER",
+		},
+		{
+			"let h = {}; h[fn(x) { x }] = 1",
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			"fn(a) { a }()",
+			"invalid parameter count. expected 1. got 0",
+		},
+		{
+			"fn(a, b = 1) { a }(1, 2, 3)",
+			"invalid parameter count. expected 1 to 2. got 3",
+		},
+		{
+			"fn(a, ...b) { a }()",
+			"invalid parameter count. expected at least 1. got 0",
+		},
+		{
+			"let [a, b] = [1];",
+			"array pattern expects 2 elements, got 1",
+		},
+		{
+			"let [a, ...b] = [];",
+			"array pattern expects at least 1 elements, got 0",
+		},
+		{
+			"let [a] = 1;",
+			"cannot destructure INTEGER as ARRAY",
+		},
+		{
+			"let {a} = [1];",
+			"cannot destructure ARRAY as HASH",
+		},
+		{
+			"let {a} = {\"b\": 1};",
+			"hash pattern key \"a\" not found",
+		},
+		{
+			"[1, 2][true:]",
+			"slice index must be INTEGER, got BOOLEAN",
+		},
+		{
+			"1[0:]",
+			"slice operator not supported: INTEGER",
+		},
+		{
+			"1.foo()",
+			"undefined method foo for INTEGER",
+		},
+		{
+			"[1, ...2]",
+			"cannot spread INTEGER",
+		},
+		{
+			"let f = fn(a) { a }; f(...[1, 2])",
+			"invalid parameter count. expected 1. got 2",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -197,6 +610,26 @@ func TestErrorHandling(t *testing.T) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
+		{
+			"5 / 0",
+			"division by zero: 5 / 0",
+		},
+		{
+			"let f = fn(x) { x % 0 }; f(5)",
+			"modulo by zero: 5 % 0",
+		},
+		{
+			"~true",
+			"unknown operator: ~BOOLEAN",
+		},
+		{
+			"1.5 & 1",
+			"unknown operator: FLOAT & INTEGER",
+		},
 		{
 			`"Hello" - "World"`,
 			"unknown operator: STRING - STRING",
@@ -220,6 +653,72 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:1"},
+		{"let x = 1;\nlet y = x + foobar;", "2:13"},
+		{"let f = fn(x) {\n  -x\n};\nf(true)", "2:3"},
+		{`len(1)`, "1:1"},
+		{"try { throw {} } finally { 1 }", "1:7"},
+		{"try { throw 1 } catch (e) { throw e + 1 } finally { 0 }", "1:29"},
+		{"try { try { -true } finally { 1 } } finally { 2 }", "1:13"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got %T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.String() != test.expected {
+			t.Errorf("wrong error position. expected %q, got %q", test.expected, errObj.Pos)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"(-9223372036854775807 - 1) * -1", "integer overflow: -9223372036854775808 * -1"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-4611686018427387904 * 2", -9223372036854775808},
+		{"5.5 * 2", 11.0},
+		{"let add = fn(a, b) { a + b }; add(9223372036854775807, 1)", "integer overflow: 9223372036854775807 + 1"},
+	}
+
+	for _, test := range tests {
+		program := parser.New(lexer.New(test.input)).ParseProgram()
+		env := object.NewEnv()
+		env.CheckedArithmetic = true
+		evaluated := Eval(program, env)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got %T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected %q, got %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestLetStatement(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -229,6 +728,7 @@ func TestLetStatement(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 5; let b = a; b;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let größe = 5; let 名前 = größe * 2; 名前;", 10},
 	}
 
 	for _, test := range tests {
@@ -293,6 +793,7 @@ func TestBuiltinfunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got 2, expected 1"},
+		{`error(1)`, "argument to `error` must be STRING, got INTEGER"},
 	}
 
 	for _, test := range tests {
@@ -314,6 +815,314 @@ func TestBuiltinfunctions(t *testing.T) {
 	}
 }
 
+func TestErrorPropagation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn() { let x = error("bad")?; 1 }; f().message()`, "bad"},
+		{"let f = fn(x) { x? + 1 }; f(1)", 2},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } len(s) }; let total = fn(a, b) { parse(a)? + parse(b)? }; total("ab", "c")`, 3},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } len(s) }; let total = fn(a, b) { parse(a)? + parse(b)? }; total("ab", "").message()`, "empty"},
+		{`let f = fn() { [1, error("e")?, 3] }; f().message()`, "e"},
+		{`let f = fn() { for (x in [1, 2]) { error("in loop")? } 5 }; f().message()`, "in loop"},
+		{`let r = 0; let f = fn() { try { error("e")? } finally { r = 1 } }; f(); r`, 1},
+		{`let f = fn() { try { error("e")? } catch (e) { 2 } }; f().message()`, "e"},
+		{`let f = fn() { try { error("e")? } catch (e) { 2 } }; f(); try { throw 1 } catch (e) { e }`, 1},
+		{`error("x").message()`, "x"},
+		{`let e = error("x"); 5`, 5},
+		{`let f = fn() { let e = try { 1 / 0 } catch (e) { e }; e?; 5 }; f().message()`, "division by zero: 1 / 0"},
+		{"let f = fn() { len(1)?; 5 }; try { f() } catch (e) { e.message() }", "argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string. expected %q, got %q", expected, str.Value)
+			}
+		}
+	}
+
+	// error values are not raised anywhere, so they get no position
+	errObj, ok := testEval(`let f = fn() { error("neg") }; f()`).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if errObj.Pos.IsValid() {
+		t.Errorf("error value has a position: %s", errObj.Pos)
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e + 1 }", 6},
+		{"try { 1 / 0 } catch (e) { e.message() }", "division by zero: 1 / 0"},
+		{`try { len(1) } catch (e) { "caught" }`, "caught"},
+		{"try { len(1) } catch (e) { e.message() }", "argument to `len` not supported, got INTEGER"},
+		{"try { throw [1, 2] } catch (e) { len(e) }", 2},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() + 1 }; try { g() } catch (e) { e }`, "deep"},
+		{"1 + try { [2, 3][fn() { throw 4 }()] } catch (e) { e }", 5},
+		{"try { throw 1 } catch { 2 }", 2},
+		{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", 20},
+		{"let r = 0; try { r = 1 } finally { r = r + 10 }; r", 11},
+		{"let r = 0; try { try { throw 1 } finally { r = 10 } } catch (e) { r + e }", 11},
+		{"let r = 0; try { try { throw 1 } catch (e) { throw 2 } finally { r = 10 } } catch (e) { r + e }", 12},
+		{"let r = 0; let f = fn() { try { return 1 } finally { r = 5 } }; f() + r", 6},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break } n = n + x } finally { n = n + 10 } } n", 21},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue } n = n + x } catch { n = 100 } } try { throw 1 } catch (e) { n + e }", 5},
+		{"let f = fn() { try { return 1 } catch (e) { 2 } }; f(); try { throw 3 } catch (e) { e }", 3},
+		{"let x = 1; try { throw 2 } catch (x) { x }; x", 1},
+		{"const e = 1; try { throw 2 } catch (e) { e }", 2},
+		{"let x = 1; try { throw 2 } catch (e) { let x = e; x } finally { 0 }; x", 1},
+		{"let e = try { 1 / 0 } catch (e) { e }; 5", 5},
+		{"try { let a = 1; } catch (e) { 2 }", nil},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string. expected %q, got %q", expected, str.Value)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let h = {"name": "monkey"}; h.name`, "monkey"},
+		{`let h = {"a": {"b": 2}}; h.a.b`, 2},
+		{`let h = {"n": 1}; h.n = h.n + 1; h.n`, 2},
+		{`[1, 2, 3].len()`, 3},
+		{`"monkey".len()`, 6},
+		{`[1, 2, 3].first() + [1, 2, 3].last()`, 4},
+		{`[1, 2, 3].rest().len()`, 2},
+		{`[1, 2, 3].join("-")`, "1-2-3"},
+		{`"a,b,c".split(",").len()`, 3},
+		{`"a,b,c".split(",")[1]`, "b"},
+		{`" Hi ".trim().upper() + "X".lower()`, "HIx"},
+		{`{"b": 2, "a": 1}.keys().join("")`, "ab"},
+		{`let m = {"double": fn(x) { x * 2 }, "keys": fn() { 1 }}; m.double(4) + m.keys()`, 9},
+		{`let args = [","]; "a,b".split(...args).len()`, 2},
+		{`3 |> [1, 2].push() |> len`, 3},
+		{`"-" |> "a-b".split() |> len`, 2},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string. expected %q, got %q", expected, str.Value)
+			}
+		}
+	}
+
+	testNullObject(t, testEval(`let h = {}; h.missing`))
+
+	// the receiver does not count as an argument
+	arityTests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a".split()`, "wrong number of arguments. got 0, expected 1"},
+		{`[1].len(2)`, "wrong number of arguments. got 1, expected 0"},
+	}
+
+	for _, test := range arityTests {
+		errObj, ok := testEval(test.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", test.input)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. expected %q, got %q", test.expected, errObj.Message)
+		}
+	}
+}
+
+func TestSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"let a = [1, 2]; let b = a[:]; b[0] = 5; a", []int{1, 2}},
+		{`"monkey"[1:4]`, "onk"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[:0]`, ""},
+		{`"héllo"[1:3]`, "él"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong number of elements for %q. expected %d, got %d",
+					test.input, len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], int64(el))
+			}
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string. expected %q, got %q", expected, str.Value)
+			}
+		}
+	}
+}
+
+var moduleFiles = map[string]string{
+	"lib/strings.monkey": `
+		import "counter.monkey" as c;
+		export let shout = fn(s) { s.upper() + "!" };
+		export let [first, second] = ["a", "b"];
+		let hidden = 1;
+		c.bump();
+	`,
+	"lib/counter.monkey": `
+		let n = 0;
+		export let bump = fn() { n = n + 1; n };
+		export let count = fn() { n };
+	`,
+	"broken.monkey":  `export let x = -true;`,
+	"cycle_a.monkey": `import "cycle_b.monkey" as b;`,
+	"cycle_b.monkey": `import "cycle_a.monkey" as a;`,
+}
+
+// writeModules writes moduleFiles to a new directory and returns a
+// loader for a main program in it
+func writeModules(t *testing.T) (*module.Loader, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range moduleFiles {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return module.NewLoader(module.NewResolver(), filepath.Join(dir, "main.monkey")), dir
+}
+
+func TestImports(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib/strings.monkey" as s; s.shout("hi")`, "HI!"},
+		{`import "lib/strings.monkey" as s; s.first + s.second`, "ab"},
+		{`import "lib/strings.monkey" as s; import "lib/counter.monkey" as c; c.bump(); c.count()`, 2},
+		{`let n = 100; import "lib/counter.monkey" as c; c.bump() + n`, 101},
+		{`let f = fn() { import "lib/counter.monkey" as c; c.count() }; f()`, 0},
+		{`import "lib/strings.monkey" as s; let t = try { s.first = "z" } catch (e) { 0 }; import "lib/strings.monkey" as u; u.first`, "a"},
+	}
+
+	for _, test := range tests {
+		program := parser.New(lexer.New(test.input)).ParseProgram()
+		env := object.NewEnv()
+		env.Modules, _ = writeModules(t)
+		evaluated := Eval(program, env)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong string. expected %q, got %q", expected, str.Value)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`import "nope.monkey" as n;`, `module "nope.monkey" not found`},
+		{`import "cycle_a.monkey" as a;`, "import cycle: DIR/cycle_a.monkey -> DIR/cycle_b.monkey -> DIR/cycle_a.monkey"},
+		{`import "broken.monkey" as b;`, "DIR/broken.monkey:1:16: "},
+		{`import "lib/strings.monkey" as s; s.hidden`, "undefined export hidden"},
+		{`import "lib/strings.monkey" as s; s.first = "z"`, "cannot assign to export first"},
+	}
+
+	for _, test := range errorTests {
+		program := parser.New(lexer.New(test.input)).ParseProgram()
+		env := object.NewEnv()
+		loader, dir := writeModules(t)
+		env.Modules = loader
+		evaluated := Eval(program, env)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got %T (%+v)", evaluated, evaluated)
+			continue
+		}
+		expected := strings.ReplaceAll(test.expectedError, "DIR", dir)
+		if !strings.Contains(errObj.Message, expected) {
+			t.Errorf("wrong error message. expected %q in %q", expected, errObj.Message)
+		}
+	}
+}
+
 func TestArrayLiteral(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -470,6 +1279,18 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{1: 5}[1.5]`,
+			nil,
+		},
 	}
 
 	for _, test := range tests {
@@ -496,6 +1317,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got %T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got %g, expected %g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -55,7 +55,7 @@ func isMacroDefinition(node ast.Statement) bool {
 		return false
 	}
 	_, isMacroLiteral := letStatement.Value.(*ast.MacroLiteral)
-	return isMacroLiteral
+	return isMacroLiteral && letStatement.Name != nil
 }
 
 func addMacro(stmt ast.Statement, env *object.Environment) {
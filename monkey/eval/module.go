@@ -0,0 +1,45 @@
+package eval
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/module"
+	"monkey/object"
+)
+
+func evalImportStatement(is *ast.ImportStatement, env *object.Environment) object.Object {
+	if env.Modules == nil {
+		return newError("cannot import %q without a module loader", is.Path.Value)
+	}
+	exports, err := env.Modules.Import(is.Path.Value, func(program *ast.Program) (object.Object, error) {
+		return evalModule(program, env)
+	})
+	if err != nil {
+		return newError("%s", err)
+	}
+	if err := define(is.Name, exports, env); err != nil {
+		return err
+	}
+	return nil
+}
+
+// evalModule runs a module in an environment of its own, with macros of
+// its own, in the arithmetic mode and with the loader of the importing
+// environment
+func evalModule(program *ast.Program, importer *object.Environment) (object.Object, error) {
+	macroEnv := object.NewEnv()
+	DefineMacros(program, macroEnv)
+	expanded := ExpandMacros(program, macroEnv).(*ast.Program)
+
+	env := object.NewEnv()
+	env.CheckedArithmetic = importer.CheckedArithmetic
+	env.Modules = importer.Modules
+	result := Eval(expanded, env)
+	if err, ok := result.(*object.Error); ok && !err.Caught {
+		return nil, fmt.Errorf("%s: %s", err.Pos, err.Message)
+	}
+	return module.Exports(expanded, func(name string) object.Object {
+		val, _ := env.Get(name)
+		return val
+	}), nil
+}
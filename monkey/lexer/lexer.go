@@ -1,34 +1,71 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
+	file         string
 	position     int
 	readPosition int
-	ch           byte
+	ch           rune
+	line         int
+	column       int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFile("", input)
+}
+
+// NewWithFile creates a Lexer whose token positions refer to filename.
+func NewWithFile(filename, input string) *Lexer {
+	l := &Lexer{input: input, file: filename, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+	l.position = l.readPosition
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+		return
 	}
-	l.position = l.readPosition
-	l.readPosition += 1
+	ch, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = ch
+	l.readPosition += width
+}
+
+// invalidChar reports whether l.ch was decoded from invalid UTF-8
+func (l *Lexer) invalidChar() bool {
+	return l.ch == utf8.RuneError && l.readPosition-l.position == 1
 }
 
 func (l *Lexer) NextToken() (tok token.Token) {
-	l.skipWhiteSpace()
+	comments, unterminated := l.skipTrivia()
+
+	pos := l.currentPosition()
+	defer func() {
+		tok.Pos = pos
+		tok.End = l.currentPosition()
+		tok.Comments = comments
+	}()
+
+	if unterminated != nil {
+		pos = unterminated.Pos
+		tok.Type = token.ILLEGAL
+		tok.Literal = fmt.Sprintf("unterminated block comment starting at line %d", pos.Line)
+		return
+	}
 
 	switch l.ch {
 	case '=':
@@ -37,6 +74,10 @@ func (l *Lexer) NextToken() (tok token.Token) {
 			l.readChar()
 			tok.Type = token.EQ
 			tok.Literal = (string(ch) + string(l.ch))
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok.Type = token.ARROW
+			tok.Literal = "=>"
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -45,7 +86,19 @@ func (l *Lexer) NextToken() (tok token.Token) {
 	case '-':
 		tok = newToken(token.MINUS, l.ch)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok.Type = token.POWER
+			tok.Literal = "**"
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
 	case '/':
 		tok = newToken(token.SLASH, l.ch)
 	case '!':
@@ -58,9 +111,60 @@ func (l *Lexer) NextToken() (tok token.Token) {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Type = token.LT_EQ
+			tok.Literal = "<="
+		} else if l.peekChar() == '<' {
+			l.readChar()
+			tok.Type = token.SHIFT_LEFT
+			tok.Literal = "<<"
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Type = token.GT_EQ
+			tok.Literal = ">="
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok.Type = token.SHIFT_RIGHT
+			tok.Literal = ">>"
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok.Type = token.AND
+			tok.Literal = "&&"
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok.Type = token.OR
+			tok.Literal = "||"
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok.Type = token.PIPE
+			tok.Literal = "|>"
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok.Type = token.ELLIPSIS
+			tok.Literal = "..."
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
+	case '?':
+		tok = newToken(token.QUESTION, l.ch)
 	case ';':
 		tok = newToken(token.SEMI, l.ch)
 	case ':':
@@ -80,58 +184,234 @@ func (l *Lexer) NextToken() (tok token.Token) {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		str, err := l.readString()
+		if err != nil {
+			tok.Type = token.ILLEGAL
+			tok.Literal = err.Error()
+		} else {
+			tok.Type = token.STRING
+			tok.Literal = str
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
+		return
 	default:
+		if l.invalidChar() {
+			tok.Type = token.ILLEGAL
+			tok.Literal = "invalid UTF-8 encoding"
+			break
+		}
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			return
 		}
 		if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
 			return
 		}
-		tok = newToken(token.ILLEGAL, l.ch)
+		tok.Type = token.ILLEGAL
+		tok.Literal = fmt.Sprintf("unexpected character %q", l.ch)
 	}
 
 	l.readChar()
 	return
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+// currentPosition returns the position of l.ch
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		File:   l.file,
+		Line:   l.line,
+		Column: l.column,
+		Offset: l.position,
+	}
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 func (l *Lexer) readIdentifier() string {
 	oldPosition := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[oldPosition:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float literal like 3.14 or 1e-9.
+// Integers may use a 0x, 0o or 0b prefix and all digits may be
+// separated by underscores, validation is left to the parser.
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	oldPosition := l.position
-	for isDigit(l.ch) {
+	var tokType token.TokenType = token.INT
+
+	if l.ch == '0' && isBasePrefix(l.peekChar()) {
+		l.readChar()
 		l.readChar()
+		for isHexDigit(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+		return tokType, l.input[oldPosition:l.position]
 	}
-	return l.input[oldPosition:l.position]
+
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(l.peekCharAt(1)) {
+			tokType = token.FLOAT
+			l.readChar()
+			l.readChar()
+			l.readDigits()
+		}
+	}
+	return tokType, l.input[oldPosition:l.position]
 }
 
-func (l *Lexer) readString() string {
-	oldPosition := l.position + 1
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+// readString reads a string literal and decodes its escape sequences.
+// After a malformed escape sequence it keeps reading up to the closing
+// quote, so lexing can continue after the string.
+func (l *Lexer) readString() (string, error) {
+	startLine := l.line
+	var out strings.Builder
+	var err error
+
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch l.ch {
+		case '"':
+			return out.String(), err
+		case 0:
+			return "", fmt.Errorf("unterminated string starting at line %d", startLine)
+		case '\\':
+			escapeErr := l.readEscape(&out)
+			if err == nil {
+				err = escapeErr
+			}
+		default:
+			if l.invalidChar() && err == nil {
+				err = fmt.Errorf("invalid UTF-8 encoding in string at %s", l.currentPosition())
+			}
+			out.WriteRune(l.ch)
 		}
 	}
-	return l.input[oldPosition:l.position]
+}
+
+// readEscape decodes the escape sequence introduced by the backslash in l.ch
+func (l *Lexer) readEscape(out *strings.Builder) error {
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\', '"':
+		out.WriteRune(l.ch)
+	case 'x':
+		value, ok := l.readHexDigits(2, 2)
+		if !ok {
+			return fmt.Errorf("invalid escape sequence: \\x must be followed by 2 hex digits")
+		}
+		out.WriteByte(byte(value))
+	case 'u':
+		if l.peekChar() != '{' {
+			return fmt.Errorf("invalid escape sequence: \\u must be followed by {hex digits}")
+		}
+		l.readChar()
+		value, ok := l.readHexDigits(1, 6)
+		if !ok || l.peekChar() != '}' {
+			return fmt.Errorf("invalid escape sequence: \\u{...} must contain 1 to 6 hex digits")
+		}
+		l.readChar()
+		if !utf8.ValidRune(rune(value)) {
+			return fmt.Errorf("invalid escape sequence: %#x is not a valid code point", value)
+		}
+		out.WriteRune(rune(value))
+	case 0:
+		// unterminated, reported by readString
+	default:
+		return fmt.Errorf("unknown escape sequence \\%c", l.ch)
+	}
+	return nil
+}
+
+// readHexDigits reads between min and max hex digits following l.ch
+func (l *Lexer) readHexDigits(min, max int) (value int, ok bool) {
+	count := 0
+	for count < max && isHexDigit(l.peekChar()) {
+		l.readChar()
+		value = value*16 + hexValue(l.ch)
+		count += 1
+	}
+	return value, count >= min
+}
+
+// skipTrivia skips whitespace and comments, returning the skipped comments.
+// If a block comment is not terminated it is returned separately.
+func (l *Lexer) skipTrivia() (comments []token.Comment, unterminated *token.Comment) {
+	for {
+		l.skipWhiteSpace()
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments, nil
+		}
+		comment, ok := l.readComment()
+		if !ok {
+			return comments, &comment
+		}
+		comments = append(comments, comment)
+	}
+}
+
+// readComment reads a line or a (possibly nested) block comment
+func (l *Lexer) readComment() (comment token.Comment, ok bool) {
+	comment.Pos = l.currentPosition()
+	oldPosition := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		ok = true
+	} else {
+		l.readChar()
+		l.readChar()
+		for depth := 1; depth > 0; {
+			switch {
+			case l.ch == 0:
+				depth = 0
+			case l.ch == '/' && l.peekChar() == '*':
+				depth += 1
+				l.readChar()
+				l.readChar()
+			case l.ch == '*' && l.peekChar() == '/':
+				depth -= 1
+				l.readChar()
+				l.readChar()
+				ok = depth == 0
+			default:
+				l.readChar()
+			}
+		}
+	}
+
+	comment.Text = l.input[oldPosition:l.position]
+	comment.End = l.currentPosition()
+	return
 }
 
 func (l *Lexer) skipWhiteSpace() {
@@ -140,21 +420,58 @@ func (l *Lexer) skipWhiteSpace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
+func (l *Lexer) peekChar() rune {
+	return l.peekCharAt(0)
+}
+
+// peekCharAt looks offset characters past the next one
+func (l *Lexer) peekCharAt(offset int) rune {
+	position := l.readPosition
+	for {
+		if position >= len(l.input) {
+			return 0
+		}
+		ch, width := utf8.DecodeRuneInString(l.input[position:])
+		if offset == 0 {
+			return ch
+		}
+		position += width
+		offset -= 1
 	}
-	return l.input[l.readPosition]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+// isDigit only accepts ASCII digits, numbers are never written in other scripts
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isWhiteSpace(ch byte) bool {
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch rune) int {
+	switch {
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	default:
+		return int(ch - '0')
+	}
+}
+
+func isWhiteSpace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
@@ -14,8 +14,14 @@ const input = `
 	};
 
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
+	5 <= 10 >= 5;
+	true && false || true;
+	x |> f?;
+	match (x) { _ => 1 }
+	let [a, ...b] = c;
+	~1 & 2 | 3 ^ 4 << 5 >> 6 % 7 ** 8;
 
 	if (5 < 10) {
 		return true;
@@ -30,6 +36,8 @@ const input = `
 	[1, 2];
 	{"foo": "bar"}
 	macro(x, y) { x + y; };
+	while (x) { break; continue; }
+	for (x in y) {}
 `
 
 type expected struct {
@@ -87,6 +95,59 @@ func TestNextToken(t *testing.T) {
 		{token.GT, ">"},
 		{token.INT, "5"},
 		{token.SEMI, ";"},
+		{token.INT, "5"},
+		{token.LT_EQ, "<="},
+		{token.INT, "10"},
+		{token.GT_EQ, ">="},
+		{token.INT, "5"},
+		{token.SEMI, ";"},
+		{token.TRUE, "true"},
+		{token.AND, "&&"},
+		{token.FALSE, "false"},
+		{token.OR, "||"},
+		{token.TRUE, "true"},
+		{token.SEMI, ";"},
+		{token.IDENT, "x"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.QUESTION, "?"},
+		{token.SEMI, ";"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LCURLY, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RCURLY, "}"},
+		{token.LET, "let"},
+		{token.LSQUARE, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RSQUARE, "]"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "c"},
+		{token.SEMI, ";"},
+		{token.BIT_NOT, "~"},
+		{token.INT, "1"},
+		{token.BIT_AND, "&"},
+		{token.INT, "2"},
+		{token.BIT_OR, "|"},
+		{token.INT, "3"},
+		{token.BIT_XOR, "^"},
+		{token.INT, "4"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.INT, "5"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.INT, "6"},
+		{token.PERCENT, "%"},
+		{token.INT, "7"},
+		{token.POWER, "**"},
+		{token.INT, "8"},
+		{token.SEMI, ";"},
 		{token.IF, "if"},
 		{token.LPAREN, "("},
 		{token.INT, "5"},
@@ -140,6 +201,24 @@ func TestNextToken(t *testing.T) {
 		{token.SEMI, ";"},
 		{token.RCURLY, "}"},
 		{token.SEMI, ";"},
+		{token.WHILE, "while"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LCURLY, "{"},
+		{token.BREAK, "break"},
+		{token.SEMI, ";"},
+		{token.CONTINUE, "continue"},
+		{token.SEMI, ";"},
+		{token.RCURLY, "}"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LCURLY, "{"},
+		{token.RCURLY, "}"},
 		{token.EOF, ""},
 	}
 
@@ -157,3 +236,216 @@ func TestNextToken(t *testing.T) {
 
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"ab\" + x;"
+
+	tests := []struct {
+		Type   token.TokenType
+		Line   int
+		Column int
+		Offset int
+		End    int
+	}{
+		{token.LET, 1, 1, 0, 3},
+		{token.IDENT, 1, 5, 4, 5},
+		{token.ASSIGN, 1, 7, 6, 7},
+		{token.INT, 1, 9, 8, 9},
+		{token.SEMI, 1, 10, 9, 10},
+		{token.STRING, 2, 3, 13, 17},
+		{token.PLUS, 2, 8, 18, 19},
+		{token.IDENT, 2, 10, 20, 21},
+		{token.SEMI, 2, 11, 21, 22},
+		{token.EOF, 2, 12, 22, 22},
+	}
+
+	l := NewWithFile("test.monkey", input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.Type {
+			t.Fatalf("tests[%d] - wrong token type. expected %q, got %q", i, test.Type, tok.Type)
+		}
+		if tok.Pos.File != "test.monkey" {
+			t.Errorf("tests[%d] - wrong file. expected %q, got %q", i, "test.monkey", tok.Pos.File)
+		}
+		if tok.Pos.Line != test.Line || tok.Pos.Column != test.Column {
+			t.Errorf("tests[%d] - wrong position. expected %d:%d, got %d:%d", i, test.Line, test.Column, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Offset != test.Offset || tok.End.Offset != test.End {
+			t.Errorf("tests[%d] - wrong offsets. expected %d-%d, got %d-%d", i, test.Offset, test.End, tok.Pos.Offset, tok.End.Offset)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "5 3.14 1e-9 2.5E+3 1e 4.foo 0xFF 0o755 0b1010 1_000_000 0x 1_000.5"
+
+	tests := []expected{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.INT, "4"},
+		{token.DOT, "."},
+		{token.IDENT, "foo"},
+		{token.INT, "0xFF"},
+		{token.INT, "0o755"},
+		{token.INT, "0b1010"},
+		{token.INT, "1_000_000"},
+		{token.INT, "0x"},
+		{token.FLOAT, "1_000.5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.Type {
+			t.Fatalf("tests[%d] - wrong token type. expected %q, got %q", i, test.Type, tok.Type)
+		}
+		if tok.Literal != test.Literal {
+			t.Fatalf("tests[%d] - wrong token literal. expected %q, got %q", i, test.Literal, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing
+/* block /* nested */ still comment */ x / 2;
+/* unterminated`
+
+	tests := []struct {
+		Type     token.TokenType
+		Literal  string
+		Comments []string
+	}{
+		{token.LET, "let", []string{"// leading comment"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "5", nil},
+		{token.SEMI, ";", nil},
+		{token.IDENT, "x", []string{"// trailing", "/* block /* nested */ still comment */"}},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.SEMI, ";", nil},
+		{token.ILLEGAL, "unterminated block comment starting at line 4", nil},
+		{token.EOF, "", nil},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.Type {
+			t.Fatalf("tests[%d] - wrong token type. expected %q, got %q", i, test.Type, tok.Type)
+		}
+		if tok.Literal != test.Literal {
+			t.Fatalf("tests[%d] - wrong token literal. expected %q, got %q", i, test.Literal, tok.Literal)
+		}
+		if len(tok.Comments) != len(test.Comments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected %d, got %d", i, len(test.Comments), len(tok.Comments))
+		}
+		for j, comment := range test.Comments {
+			if tok.Comments[j].Text != comment {
+				t.Errorf("tests[%d] - wrong comment. expected %q, got %q", i, comment, tok.Comments[j].Text)
+			}
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		Type     token.TokenType
+		expected string
+	}{
+		{`"a\nb"`, token.STRING, "a\nb"},
+		{`"tab\there"`, token.STRING, "tab\there"},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"\x41\x62"`, token.STRING, "Ab"},
+		{`"\u{48}\u{e9}\u{1F600}"`, token.STRING, "Hé😀"},
+		{`"日本"`, token.STRING, "日本"},
+		{`"\q"`, token.ILLEGAL, `unknown escape sequence \q`},
+		{`"\x4"`, token.ILLEGAL, `invalid escape sequence: \x must be followed by 2 hex digits`},
+		{`"\u{110000}"`, token.ILLEGAL, `invalid escape sequence: 0x110000 is not a valid code point`},
+		{`"\u41"`, token.ILLEGAL, `invalid escape sequence: \u must be followed by {hex digits}`},
+		{"\n\"never closed;\nlet x = 1;", token.ILLEGAL, "unterminated string starting at line 2"},
+	}
+
+	for i, test := range tests {
+		l := New(test.input)
+		tok := l.NextToken()
+
+		if tok.Type != test.Type {
+			t.Fatalf("tests[%d] - wrong token type. expected %q, got %q", i, test.Type, tok.Type)
+		}
+		if tok.Literal != test.expected {
+			t.Errorf("tests[%d] - wrong token literal. expected %q, got %q", i, test.expected, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF && test.Type == token.STRING {
+			t.Errorf("tests[%d] - expected EOF after string, got %q", i, next.Type)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let größe = \"名前\"; 名前2 + x1;\n\xff é"
+
+	tests := []struct {
+		Type    token.TokenType
+		Literal string
+		Line    int
+		Column  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "größe", 1, 5},
+		{token.ASSIGN, "=", 1, 11},
+		{token.STRING, "名前", 1, 13},
+		{token.SEMI, ";", 1, 17},
+		{token.IDENT, "名前2", 1, 19},
+		{token.PLUS, "+", 1, 23},
+		{token.IDENT, "x1", 1, 25},
+		{token.SEMI, ";", 1, 27},
+		{token.ILLEGAL, "invalid UTF-8 encoding", 2, 1},
+		{token.IDENT, "é", 2, 3},
+		{token.EOF, "", 2, 4},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.Type {
+			t.Fatalf("tests[%d] - wrong token type. expected %q, got %q", i, test.Type, tok.Type)
+		}
+		if tok.Literal != test.Literal {
+			t.Fatalf("tests[%d] - wrong token literal. expected %q, got %q", i, test.Literal, tok.Literal)
+		}
+		if tok.Pos.Line != test.Line || tok.Pos.Column != test.Column {
+			t.Errorf("tests[%d] - wrong position. expected %d:%d, got %d:%d", i, test.Line, test.Column, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+func TestInvalidUTF8InString(t *testing.T) {
+	l := New("\"ab\xffc\"")
+	tok := l.NextToken()
+
+	expected := "invalid UTF-8 encoding in string at 1:4"
+	if tok.Type != token.ILLEGAL || tok.Literal != expected {
+		t.Fatalf("wrong token. expected ILLEGAL %q, got %q %q", expected, tok.Type, tok.Literal)
+	}
+	if next := l.NextToken(); next.Type != token.EOF {
+		t.Errorf("expected EOF after string, got %q", next.Type)
+	}
+}
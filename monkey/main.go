@@ -1,18 +1,29 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"monkey/eval"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
 	"monkey/repl"
 	"os"
+	"path/filepath"
 )
 
+var checked = flag.Bool("checked", false, "report integer overflow as a runtime error")
+var jsonErrors = flag.Bool("json", false, "print parser errors as JSON")
+var searchPath = flag.String("path", "", "directories searched for imported modules, separated by "+string(os.PathListSeparator))
+
 func main() {
-	if len(os.Args) > 1 {
-		runFile(os.Args[1])
+	flag.Parse()
+	repl.CheckedArithmetic = *checked
+	repl.Resolver = module.NewResolver(filepath.SplitList(*searchPath)...)
+
+	if flag.NArg() > 0 {
+		runFile(flag.Arg(0))
 	} else {
 		startRepl()
 	}
@@ -34,18 +45,31 @@ func runFile(filename string) {
 	input := string(fContent)
 	macroEnv := object.NewEnv()
 
-	lexer := lexer.New(input)
-	parser := parser.New(lexer)
-	program := parser.ParseProgram()
+	l := lexer.NewWithFile(filename, input)
+	p := parser.New(l)
+	program := p.ParseProgram()
 
-	if len(parser.Errors()) > 0 {
-		fmt.Println("Error parsing program")
-		for _, msg := range parser.Errors() {
-			fmt.Println(msg)
+	if len(p.Errors()) > 0 {
+		if *jsonErrors {
+			if err := parser.WriteJSON(os.Stdout, p.Errors()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing parser errors: %s\n", err)
+				os.Exit(1)
+			}
+		} else {
+			parser.RenderAll(os.Stderr, input, p.Errors())
+		}
+		if parser.HasErrors(p.Errors()) {
+			os.Exit(1)
 		}
-		return
 	}
 	eval.DefineMacros(program, macroEnv)
 	expanded := eval.ExpandMacros(program, macroEnv)
-	eval.Eval(expanded, object.NewEnv())
+	env := object.NewEnv()
+	env.CheckedArithmetic = *checked
+	env.Modules = module.NewLoader(repl.Resolver, filename)
+	result := eval.Eval(expanded, env)
+	if errObj, ok := result.(*object.Error); ok && !errObj.Caught {
+		fmt.Println(errObj.Inspect())
+		os.Exit(1)
+	}
 }
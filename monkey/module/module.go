@@ -0,0 +1,143 @@
+// Package module finds, parses and caches the modules imported with
+// import "path" as name;
+package module
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resolver turns import paths into file names. A path is looked up
+// relative to the directory of the importing file first and then in
+// each of the SearchPaths in turn.
+type Resolver struct {
+	SearchPaths []string
+}
+
+func NewResolver(searchPaths ...string) *Resolver {
+	return &Resolver{SearchPaths: searchPaths}
+}
+
+// Resolve returns the file that path imported from the file from refers
+// to. from is empty for imports outside of any file, like in the REPL.
+func (r *Resolver) Resolve(path, from string) (string, error) {
+	if filepath.IsAbs(path) {
+		if isFile(path) {
+			return filepath.Clean(path), nil
+		}
+		return "", fmt.Errorf("module %q not found", path)
+	}
+
+	dirs := append([]string{filepath.Dir(from)}, r.SearchPaths...)
+	for _, dir := range dirs {
+		filename := filepath.Join(dir, path)
+		if isFile(filename) {
+			return filename, nil
+		}
+	}
+	return "", fmt.Errorf("module %q not found", path)
+}
+
+func isFile(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && !info.IsDir()
+}
+
+// InitFunc runs the program of a module and returns its exports
+type InitFunc = func(program *ast.Program) (object.Object, error)
+
+// Loader initializes each module once and hands out its cached exports
+// after that. Modules that import each other, directly or not, are
+// reported as an import cycle.
+type Loader struct {
+	resolver *Resolver
+	main     string
+	modules  map[string]object.Object
+	// loading are the modules being initialized, innermost last
+	loading []string
+}
+
+// NewLoader returns a loader for the imports of the program in the file
+// main, which may be empty if the program isn't read from a file
+func NewLoader(resolver *Resolver, main string) *Loader {
+	return &Loader{
+		resolver: resolver,
+		main:     main,
+		modules:  map[string]object.Object{},
+	}
+}
+
+// Import returns the exports of the module at path, initializing it
+// with init unless that has been done before
+func (l *Loader) Import(path string, init InitFunc) (object.Object, error) {
+	from := l.main
+	if n := len(l.loading); n > 0 {
+		from = l.loading[n-1]
+	}
+	filename, err := l.resolver.Resolve(path, from)
+	if err != nil {
+		return nil, err
+	}
+	if exports, ok := l.modules[filename]; ok {
+		return exports, nil
+	}
+	for i, loading := range l.loading {
+		if loading == filename {
+			cycle := append([]string{}, l.loading[i:]...)
+			cycle = append(cycle, filename)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	program, err := parse(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	l.loading = append(l.loading, filename)
+	exports, err := init(program)
+	l.loading = l.loading[:len(l.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+	l.modules[filename] = exports
+	return exports, nil
+}
+
+func parse(filename string) (*ast.Program, error) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.NewWithFile(filename, string(source)))
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		if err.Severity == parser.SeverityError {
+			return nil, err
+		}
+	}
+	return program, nil
+}
+
+// Exports collects the exported names of a module into a hash, get
+// returns the value of a name after the module ran
+func Exports(program *ast.Program, get func(name string) object.Object) *object.Hash {
+	exports := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}, Exports: true}
+	for _, statement := range program.Statements {
+		export, ok := statement.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		for _, name := range export.Let.Names() {
+			key := &object.String{Value: name}
+			exports.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: get(name)}
+		}
+	}
+	return exports
+}
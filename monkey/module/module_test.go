@@ -0,0 +1,162 @@
+package module
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.monkey":            "",
+		"lib/strings.monkey":     "",
+		"lib/util.monkey":        "",
+		"vendor/util.monkey":     "",
+		"vendor/extra.monkey":    "",
+		"vendor/nested/x.monkey": "",
+	})
+	vendor := filepath.Join(dir, "vendor")
+	resolver := NewResolver(vendor)
+	main := filepath.Join(dir, "main.monkey")
+	strings := filepath.Join(dir, "lib/strings.monkey")
+
+	tests := []struct {
+		path     string
+		from     string
+		expected string
+	}{
+		{"lib/strings.monkey", main, strings},
+		{"util.monkey", strings, filepath.Join(dir, "lib/util.monkey")},
+		{"../main.monkey", strings, main},
+		{"extra.monkey", main, filepath.Join(vendor, "extra.monkey")},
+		{"util.monkey", main, filepath.Join(vendor, "util.monkey")},
+		{strings, "", strings},
+	}
+
+	for _, tt := range tests {
+		filename, err := resolver.Resolve(tt.path, tt.from)
+		if err != nil {
+			t.Errorf("resolving %q from %q failed: %s", tt.path, tt.from, err)
+			continue
+		}
+		if filename != tt.expected {
+			t.Errorf("wrong file for %q from %q. expected %q, got %q", tt.path, tt.from, tt.expected, filename)
+		}
+	}
+
+	for _, path := range []string{"missing.monkey", "lib", "nested"} {
+		_, err := resolver.Resolve(path, main)
+		if err == nil {
+			t.Errorf("expected %q not to resolve", path)
+			continue
+		}
+		expected := `module "` + path + `" not found`
+		if err.Error() != expected {
+			t.Errorf("wrong error. expected %q, got %q", expected, err)
+		}
+	}
+}
+
+// importAll is an InitFunc that imports the imports of a module and
+// counts how often each module was initialized
+func importAll(loader *Loader, inits map[string]int) InitFunc {
+	var init InitFunc
+	init = func(program *ast.Program) (object.Object, error) {
+		for _, statement := range program.Statements {
+			if is, ok := statement.(*ast.ImportStatement); ok {
+				if _, err := loader.Import(is.Path.Value, init); err != nil {
+					return nil, err
+				}
+			}
+		}
+		inits[program.Statements[0].Pos().File] += 1
+		return Exports(program, func(name string) object.Object {
+			return &object.String{Value: name}
+		}), nil
+	}
+	return init
+}
+
+func TestLoaderInitializesModulesOnce(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.monkey":     `import "lib/b.monkey" as b; import "lib/c.monkey" as c; export let a = 1;`,
+		"lib/b.monkey": `import "c.monkey" as c; export let [b, ...rest] = [];`,
+		"lib/c.monkey": `export let c = 1; let hidden = 2;`,
+	})
+	loader := NewLoader(NewResolver(), filepath.Join(dir, "main.monkey"))
+	inits := map[string]int{}
+
+	exports, err := loader.Import("a.monkey", importAll(loader, inits))
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+	_, err = loader.Import("lib/c.monkey", importAll(loader, inits))
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+
+	for _, name := range []string{"a.monkey", "lib/b.monkey", "lib/c.monkey"} {
+		if n := inits[filepath.Join(dir, name)]; n != 1 {
+			t.Errorf("%s was initialized %d times", name, n)
+		}
+	}
+	if exports.Inspect() != "{a: a}" {
+		t.Errorf("wrong exports. got %s", exports.Inspect())
+	}
+	b, _ := loader.Import("lib/b.monkey", nil)
+	if len(b.(*object.Hash).Pairs) != 2 {
+		t.Errorf("wrong exports. got %s", b.Inspect())
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.monkey": `import "b.monkey" as b;`,
+		"b.monkey": `import "c.monkey" as c;`,
+		"c.monkey": `import "b.monkey" as b;`,
+	})
+	loader := NewLoader(NewResolver(), filepath.Join(dir, "main.monkey"))
+
+	_, err := loader.Import("a.monkey", importAll(loader, map[string]int{}))
+	if err == nil {
+		t.Fatalf("expected an import cycle error")
+	}
+	b, c := filepath.Join(dir, "b.monkey"), filepath.Join(dir, "c.monkey")
+	expected := "import cycle: " + b + " -> " + c + " -> " + b
+	if err.Error() != expected {
+		t.Errorf("wrong error. expected %q, got %q", expected, err)
+	}
+}
+
+func TestImportParseError(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"bad.monkey": "let x 1;",
+	})
+	loader := NewLoader(NewResolver(), filepath.Join(dir, "main.monkey"))
+
+	_, err := loader.Import("bad.monkey", importAll(loader, map[string]int{}))
+	if err == nil {
+		t.Fatalf("expected a parse error")
+	}
+	expected := filepath.Join(dir, "bad.monkey") + ":1:7: expected next token to be =, got INT"
+	if err.Error() != expected {
+		t.Errorf("wrong error. expected %q, got %q", expected, err)
+	}
+}
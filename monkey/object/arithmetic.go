@@ -0,0 +1,48 @@
+package object
+
+import "math"
+
+// IntMod returns the remainder of a / b. Division truncates toward zero,
+// so the remainder has the sign of a: -7 % 3 == -1.
+func IntMod(a, b int64) int64 {
+	return a % b
+}
+
+// IntPow computes base ** exp for exp >= 0 by repeated squaring,
+// overflowing results wrap around like the other integer operators
+func IntPow(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+// IntegerOverflows reports whether leftVal operator rightVal does not
+// fit into an int64, for the operators + - * and /
+func IntegerOverflows(operator string, leftVal, rightVal int64) bool {
+	switch operator {
+	case "+":
+		result := leftVal + rightVal
+		return (rightVal > 0 && result < leftVal) || (rightVal < 0 && result > leftVal)
+	case "-":
+		result := leftVal - rightVal
+		return (rightVal > 0 && result > leftVal) || (rightVal < 0 && result < leftVal)
+	case "*":
+		if leftVal == 0 || rightVal == 0 {
+			return false
+		}
+		result := leftVal * rightVal
+		if leftVal == -1 || rightVal == -1 {
+			return leftVal == math.MinInt64 || rightVal == math.MinInt64
+		}
+		return result/rightVal != leftVal
+	case "/":
+		return leftVal == math.MinInt64 && rightVal == -1
+	}
+	return false
+}
@@ -23,6 +23,62 @@ var Builtins = []struct {
 	{"append", &Builtin{Fn: monkeyPush}},
 	{"exit", &Builtin{Fn: exit}},
 	{"quit", &Builtin{Fn: exit}},
+	{"error", &Builtin{Fn: monkeyError}},
+}
+
+// Method is a builtin that can be called as value.name(args). Fn gets
+// value as its first argument, Arity counts the args after it.
+type Method struct {
+	Fn    BuiltinFunction
+	Arity int
+}
+
+// Methods holds the methods by the type of value
+var Methods = map[ObjectType]map[string]Method{
+	STRING_OBJ: {
+		"len":   {Fn: monkeyLen},
+		"split": {Fn: stringSplit, Arity: 1},
+		"upper": {Fn: stringUpper},
+		"lower": {Fn: stringLower},
+		"trim":  {Fn: stringTrim},
+	},
+	ARRAY_OBJ: {
+		"len":   {Fn: monkeyLen},
+		"first": {Fn: monkeyHead},
+		"last":  {Fn: monkeyBack},
+		"rest":  {Fn: monkeyTail},
+		"push":  {Fn: monkeyPush, Arity: 1},
+		"join":  {Fn: arrayJoin, Arity: 1},
+	},
+	HASH_OBJ: {
+		"keys":   {Fn: hashKeys},
+		"values": {Fn: hashValues},
+	},
+	ERROR_OBJ: {
+		"message": {Fn: errorMessage},
+	},
+}
+
+// GetMember resolves the name of value.name(args). A hash key of that
+// name takes precedence over the methods of HASH, so hashes of functions
+// can be called like modules. Methods come bound to value.
+func GetMember(value Object, name string) (Object, bool) {
+	if hash, ok := value.(*Hash); ok {
+		if pair, ok := hash.Pairs[(&String{Value: name}).HashKey()]; ok {
+			return pair.Value, true
+		}
+	}
+	method, ok := Methods[value.Type()][name]
+	if !ok {
+		return nil, false
+	}
+	return &Builtin{Fn: func(args ...Object) Object {
+		// checked here, the receiver would count as an argument in Fn
+		if len(args) != method.Arity {
+			return newError("wrong number of arguments. got %d, expected %d", len(args), method.Arity)
+		}
+		return method.Fn(append([]Object{value}, args...)...)
+	}}, true
 }
 
 func GetBuildinByName(name string) *Builtin {
@@ -124,6 +180,115 @@ func exit(args ...Object) Object {
 	return nil
 }
 
+func stringSplit(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got %d, expected %d", len(args), 2)
+	}
+	str, ok1 := args[0].(*String)
+	sep, ok2 := args[1].(*String)
+	if !ok1 || !ok2 {
+		return newError("arguments to `split` must be STRING, got %s and %s", args[0].Type(), args[1].Type())
+	}
+	elements := []Object{}
+	for _, part := range strings.Split(str.Value, sep.Value) {
+		elements = append(elements, &String{Value: part})
+	}
+	return &Array{Elements: elements}
+}
+
+func stringUpper(args ...Object) Object {
+	return mapString("upper", strings.ToUpper, args)
+}
+
+func stringLower(args ...Object) Object {
+	return mapString("lower", strings.ToLower, args)
+}
+
+func stringTrim(args ...Object) Object {
+	return mapString("trim", strings.TrimSpace, args)
+}
+
+func mapString(name string, fn func(string) string, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got %d, expected %d", len(args), 1)
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	return &String{Value: fn(str.Value)}
+}
+
+func arrayJoin(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got %d, expected %d", len(args), 2)
+	}
+	arr, ok1 := args[0].(*Array)
+	sep, ok2 := args[1].(*String)
+	if !ok1 || !ok2 {
+		return newError("arguments to `join` must be ARRAY and STRING, got %s and %s", args[0].Type(), args[1].Type())
+	}
+	parts := []string{}
+	for _, el := range arr.Elements {
+		parts = append(parts, el.Inspect())
+	}
+	return &String{Value: strings.Join(parts, sep.Value)}
+}
+
+func hashKeys(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got %d, expected %d", len(args), 1)
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+	}
+	keys := []Object{}
+	for _, pair := range sortedPairs(hash) {
+		keys = append(keys, pair.Key)
+	}
+	return &Array{Elements: keys}
+}
+
+func hashValues(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got %d, expected %d", len(args), 1)
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `values` must be HASH, got %s", args[0].Type())
+	}
+	values := []Object{}
+	for _, pair := range sortedPairs(hash) {
+		values = append(values, pair.Value)
+	}
+	return &Array{Elements: values}
+}
+
+// monkeyError makes an error value, which is returned by ? rather than
+// raised
+func monkeyError(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got %d, expected %d", len(args), 1)
+	}
+	message, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `error` must be STRING, got %s", args[0].Type())
+	}
+	return &Error{Message: message.Value, Caught: true}
+}
+
+func errorMessage(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got %d, expected %d", len(args), 1)
+	}
+	err, ok := args[0].(*Error)
+	if !ok {
+		return newError("argument to `message` must be ERROR, got %s", args[0].Type())
+	}
+	return &String{Value: err.Message}
+}
+
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -1,8 +1,29 @@
 package object
 
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// ModuleLoader loads the modules of import statements, init runs the
+// program of a module and returns its exports
+type ModuleLoader interface {
+	Import(path string, init func(program *ast.Program) (Object, error)) (Object, error)
+}
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// consts holds where the constants of store were declared
+	consts map[string]token.Position
+
+	// CheckedArithmetic makes integer overflow in + - * and / an error
+	// instead of wrapping around, inner environments inherit it.
+	CheckedArithmetic bool
+	// Modules loads the modules of import statements, importing fails
+	// while it is nil. Inner environments inherit it.
+	Modules ModuleLoader
 }
 
 func NewEnv() *Environment {
@@ -13,6 +34,8 @@ func NewEnv() *Environment {
 func NewInnerEnv(outer *Environment) (e *Environment) {
 	e = NewEnv()
 	e.outer = outer
+	e.CheckedArithmetic = outer.CheckedArithmetic
+	e.Modules = outer.Modules
 	return e
 }
 
@@ -24,7 +47,41 @@ func (e *Environment) Get(name string) (obj Object, ok bool) {
 	return
 }
 
-func (e *Environment) Set(name string, obj Object) Object {
+// Set binds name in e, it fails if name is bound to a constant of e.
+// Constants of outer environments can be shadowed.
+func (e *Environment) Set(name string, obj Object) (Object, error) {
+	if pos, ok := e.consts[name]; ok {
+		return nil, fmt.Errorf("cannot assign to constant %s, declared at %s", name, pos)
+	}
 	e.store[name] = obj
-	return obj
+	return obj, nil
+}
+
+// SetConst binds name like Set, as a constant declared at pos that
+// Assign refuses to change
+func (e *Environment) SetConst(name string, obj Object, pos token.Position) (Object, error) {
+	if _, err := e.Set(name, obj); err != nil {
+		return nil, err
+	}
+	if e.consts == nil {
+		e.consts = make(map[string]token.Position)
+	}
+	e.consts[name] = pos
+	return obj, nil
+}
+
+// Assign updates the binding of name in the innermost environment that
+// has one, it fails if name is not bound at all or bound to a constant
+func (e *Environment) Assign(name string, obj Object) (Object, error) {
+	if _, ok := e.store[name]; ok {
+		if pos, ok := e.consts[name]; ok {
+			return nil, fmt.Errorf("cannot assign to constant %s, declared at %s", name, pos)
+		}
+		e.store[name] = obj
+		return obj, nil
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, obj)
+	}
+	return nil, fmt.Errorf("identifier not found: %s", name)
 }
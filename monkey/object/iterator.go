@@ -0,0 +1,81 @@
+package object
+
+import "sort"
+
+// Iterator steps through the elements of an array, the characters of a
+// string or the keys of a hash, in that order. Hash keys are sorted so
+// iterating a hash is deterministic.
+type Iterator struct {
+	Elements []Object
+	next     int
+}
+
+// NewIterator returns an iterator over obj, or false if obj can not be
+// iterated
+func NewIterator(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return &Iterator{Elements: obj.Elements}, true
+	case *String:
+		elements := []Object{}
+		for _, ch := range obj.Value {
+			elements = append(elements, &String{Value: string(ch)})
+		}
+		return &Iterator{Elements: elements}, true
+	case *Hash:
+		keys := []Object{}
+		for _, pair := range sortedPairs(obj) {
+			keys = append(keys, pair.Key)
+		}
+		return &Iterator{Elements: keys}, true
+	default:
+		return nil, false
+	}
+}
+
+func (it *Iterator) Type() ObjectType {
+	return ITERATOR_OBJ
+}
+func (it *Iterator) Inspect() string {
+	return "iterator"
+}
+
+// Next returns the next element, or false once all elements were returned
+func (it *Iterator) Next() (Object, bool) {
+	if it.next >= len(it.Elements) {
+		return nil, false
+	}
+	el := it.Elements[it.next]
+	it.next += 1
+	return el, true
+}
+
+// sortedPairs returns the pairs of hash ordered by their keys
+func sortedPairs(hash *Hash) []HashPair {
+	pairs := make([]HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+// keyLess orders hash keys by type first and then by value
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Float:
+		return a.Value < b.(*Float).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	}
+	return false
+}
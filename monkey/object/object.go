@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/token"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +16,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
@@ -26,6 +30,10 @@ const (
 	QUOTE_OBJ             = "QUOTE"
 	MACRO_OBJ             = "MACRO"
 	CLOSURE_OBJ           = "CLOSURE"
+	ITERATOR_OBJ          = "ITERATOR"
+	CELL_OBJ              = "CELL"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
 )
 
 type Object interface {
@@ -42,6 +50,38 @@ type HashKey struct {
 	Value uint64
 }
 
+// Equal reports whether a == b for the scalars a and b, which is what a
+// literal pattern of a match arm compares. Like == it compares integers
+// and floats by their value, so 1 equals 1.0. Other scalars have to be
+// of the same type and value.
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *Float:
+			return float64(a.Value) == b.Value
+		}
+		return false
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == float64(b.Value)
+		case *Float:
+			return a.Value == b.Value
+		}
+		return false
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	}
+	return false
+}
+
 type Integer struct {
 	Value int64
 }
@@ -56,6 +96,29 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep floats with integral values distinguishable from integers
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) HashKey() HashKey {
+	// 1.0 == 1, so integral floats must find the entry stored under 1
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -120,6 +183,10 @@ type HashPair struct {
 
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	// Exports is set for the exports of a module, which every importer
+	// shares. They can't be assigned to and indexing a name the module
+	// doesn't export is an error.
+	Exports bool
 }
 
 func (h *Hash) Type() ObjectType {
@@ -147,6 +214,26 @@ func (n *Null) Inspect() string {
 	return "null"
 }
 
+// Break and Continue are passed up from a break or continue statement
+// to the loop it belongs to
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
 type ReturnValue struct {
 	Value Object
 }
@@ -160,29 +247,66 @@ func (rv *ReturnValue) Inspect() string {
 
 type Error struct {
 	Message string
+	// Pos is the source location the error was raised at, if known
+	Pos token.Position
+	// Value is the value thrown by a throw statement, nil for runtime
+	// errors
+	Value Object
+	// Caught marks an error that is held as an ordinary value, like the
+	// one bound by a catch block. The evaluator aborts on all others.
+	Caught bool
 }
 
 func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
 func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR " + e.Pos.String() + ": " + e.Message
+	}
 	return "ERROR " + e.Message
 }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
 
+// Arity returns the minimal and maximal number of arguments f accepts,
+// max is -1 if there is no upper limit
+func (f *Function) Arity() (min, max int) {
+	min = len(f.Parameters)
+	for i, def := range f.Defaults {
+		if def != nil {
+			min = i
+			break
+		}
+	}
+	max = len(f.Parameters)
+	if f.Rest != nil {
+		max = -1
+	}
+	return min, max
+}
+
 func (f *Function) Type() ObjectType {
 	return FUNCTION_OBJ
 }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn")
@@ -245,10 +369,44 @@ func (m *Macro) Inspect() string {
 	return out.String()
 }
 
+// FormatArity describes the number of arguments a function accepts,
+// like "2", "1 to 2" or "at least 1"
+func FormatArity(min, max int) string {
+	switch max {
+	case -1:
+		return fmt.Sprintf("at least %d", min)
+	case min:
+		return fmt.Sprintf("%d", min)
+	default:
+		return fmt.Sprintf("%d to %d", min, max)
+	}
+}
+
 type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	// MinParameters is the number of parameters without default value,
+	// calls may leave out the others
+	MinParameters int
+	// Variadic functions collect the arguments after the last parameter
+	// into an array, stored in the local after the parameters
+	Variadic bool
+	// Entries holds the instruction offset a call starts at for each
+	// argument count from MinParameters to NumParameters, the code
+	// before the last entry computes the missing default values. It is
+	// empty if no parameter has a default value.
+	Entries   []int
+	SourceMap code.SourceMap
+}
+
+// Arity returns the minimal and maximal number of arguments f accepts,
+// max is -1 if there is no upper limit
+func (f *CompiledFunction) Arity() (min, max int) {
+	if f.Variadic {
+		return f.MinParameters, -1
+	}
+	return f.MinParameters, f.NumParameters
 }
 
 func (f *CompiledFunction) Type() ObjectType {
@@ -259,9 +417,27 @@ func (f *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", f)
 }
 
+// Cell holds a local variable that was captured by a closure, so the
+// closure and the function the variable belongs to see each other's
+// assignments to it
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%s]", c.Value.Inspect())
+}
+
 type Closure struct {
 	Fn   *CompiledFunction
 	Free []Object
+	// Constants and Globals belong to the module the closure was created
+	// in, the closure runs with them wherever it is called from
+	Constants []Object
+	Globals   []Object
 }
 
 func (c *Closure) Type() ObjectType {
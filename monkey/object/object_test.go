@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +23,55 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have different hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{3, "3.0"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+	}
+
+	for _, test := range tests {
+		f := &Float{Value: test.value}
+		if f.Inspect() != test.expected {
+			t.Errorf("wrong Inspect() output. expected %q, got %q", test.expected, f.Inspect())
+		}
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	oneFloat := &Float{Value: 1.0}
+	half := &Float{Value: 0.5}
+
+	if one.HashKey() != oneFloat.HashKey() {
+		t.Errorf("integral float has a different hash key than the equal integer")
+	}
+
+	if (&Float{Value: -0.0}).HashKey() != (&Integer{Value: 0}).HashKey() {
+		t.Errorf("negative zero has a different hash key than 0")
+	}
+
+	if half.HashKey() == (&Integer{Value: 0}).HashKey() {
+		t.Errorf("fractional float has the same hash key as an integer")
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	if got := IntMod(-7, 3); got != -1 {
+		t.Errorf("-7 %% 3 should truncate toward zero. got %d", got)
+	}
+	if got := IntPow(3, 4); got != 81 {
+		t.Errorf("3 ** 4 should be 81. got %d", got)
+	}
+	if !IntegerOverflows("*", math.MaxInt64/2+1, 2) {
+		t.Errorf("MaxInt64/2+1 * 2 should overflow")
+	}
+	if IntegerOverflows("%", math.MinInt64, -1) {
+		t.Errorf("only + - * and / are checked for overflow")
+	}
+}
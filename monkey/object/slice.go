@@ -0,0 +1,65 @@
+package object
+
+import "fmt"
+
+// Slice returns the elements of an array, or the characters of a string,
+// from low up to high. A NULL bound stands for the start or the end,
+// negative bounds count from the end and bounds past either end are
+// clamped to it.
+func Slice(left, low, high Object) (Object, error) {
+	switch left := left.(type) {
+	case *Array:
+		from, to, err := sliceBounds(len(left.Elements), low, high)
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]Object, to-from)
+		copy(elements, left.Elements[from:to])
+		return &Array{Elements: elements}, nil
+	case *String:
+		runes := []rune(left.Value)
+		from, to, err := sliceBounds(len(runes), low, high)
+		if err != nil {
+			return nil, err
+		}
+		return &String{Value: string(runes[from:to])}, nil
+	default:
+		return nil, fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+}
+
+func sliceBounds(length int, low, high Object) (int, int, error) {
+	from, err := sliceIndex(low, 0, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := sliceIndex(high, length, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		to = from
+	}
+	return from, to, nil
+}
+
+func sliceIndex(index Object, missing, length int) (int, error) {
+	switch index := index.(type) {
+	case *Null:
+		return missing, nil
+	case *Integer:
+		i := index.Value
+		if i < 0 {
+			i += int64(length)
+		}
+		if i < 0 {
+			return 0, nil
+		}
+		if i > int64(length) {
+			return length, nil
+		}
+		return int(i), nil
+	default:
+		return 0, fmt.Errorf("slice index must be INTEGER, got %s", index.Type())
+	}
+}
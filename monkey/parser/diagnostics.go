@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/token"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseError is a diagnostic found while parsing. Pos and End span the
+// offending source, Expected lists the token types that would have been
+// valid instead of Actual, if the error is about an unexpected token.
+type ParseError struct {
+	Severity Severity          `json:"severity"`
+	Message  string            `json:"message"`
+	Pos      token.Position    `json:"pos"`
+	End      token.Position    `json:"end"`
+	Expected []token.TokenType `json:"expected,omitempty"`
+	Actual   token.TokenType   `json:"actual,omitempty"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Render writes err followed by the source line it points at and a
+// caret marking its span, like
+//
+//	main.monkey:2:7: error: expected next token to be =, got INT
+//	let y 7;
+//	      ^
+func Render(out io.Writer, source string, err *ParseError) {
+	fmt.Fprintf(out, "%s: %s: %s\n", err.Pos, err.Severity, err.Message)
+	if !err.Pos.IsValid() || err.Pos.Offset > len(source) {
+		return
+	}
+
+	lineStart := strings.LastIndexByte(source[:err.Pos.Offset], '\n') + 1
+	lineEnd := strings.IndexByte(source[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += lineStart
+	}
+	line := strings.TrimRight(source[lineStart:lineEnd], "\r")
+
+	// keep tabs so the caret lines up with the source line
+	var indent strings.Builder
+	for _, ch := range source[lineStart:err.Pos.Offset] {
+		if ch == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+
+	width := 1
+	if err.End.Offset > err.Pos.Offset && err.End.Offset <= lineEnd {
+		width = utf8.RuneCountInString(source[err.Pos.Offset:err.End.Offset])
+	}
+
+	fmt.Fprintf(out, "%s\n%s%s\n", line, indent.String(), strings.Repeat("^", width))
+}
+
+// HasErrors reports whether any of errs is an error rather than a warning
+func HasErrors(errs []*ParseError) bool {
+	for _, err := range errs {
+		if err.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderAll renders each of errs in turn
+func RenderAll(out io.Writer, source string, errs []*ParseError) {
+	for _, err := range errs {
+		Render(out, source, err)
+	}
+}
+
+// WriteJSON writes errs as a JSON array, for editors and other tools
+func WriteJSON(out io.Writer, errs []*ParseError) error {
+	if errs == nil {
+		errs = []*ParseError{}
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(errs)
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
@@ -10,26 +11,50 @@ import (
 
 const (
 	LOWEST       = iota
+	ASSIGN       // =
+	LOGICAL_OR   // ||
+	LOGICAL_AND  // &&
 	EQUALS       // ==
 	LESS_GREATER // < or >
+	PIPE         // |>
+	BITWISE_OR   // |
+	BITWISE_XOR  // ^
+	BITWISE_AND  // &
+	SHIFT        // << or >>
 	SUM          // +
-	PRODUCT      // *
-	PREFIX       // -X or !X
+	PRODUCT      // * / %
+	PREFIX       // -X or !X or ~X
+	POWER        // **
 	CALL         // functionCall(X)
 	INDEX        // arr[X]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESS_GREATER,
-	token.GT:       LESS_GREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LSQUARE:  INDEX,
+	token.ASSIGN:      ASSIGN,
+	token.OR:          LOGICAL_OR,
+	token.AND:         LOGICAL_AND,
+	token.EQ:          EQUALS,
+	token.NOT_EQ:      EQUALS,
+	token.LT:          LESS_GREATER,
+	token.GT:          LESS_GREATER,
+	token.LT_EQ:       LESS_GREATER,
+	token.GT_EQ:       LESS_GREATER,
+	token.PIPE:        PIPE,
+	token.BIT_OR:      BITWISE_OR,
+	token.BIT_XOR:     BITWISE_XOR,
+	token.BIT_AND:     BITWISE_AND,
+	token.SHIFT_LEFT:  SHIFT,
+	token.SHIFT_RIGHT: SHIFT,
+	token.PLUS:        SUM,
+	token.MINUS:       SUM,
+	token.SLASH:       PRODUCT,
+	token.ASTERISK:    PRODUCT,
+	token.PERCENT:     PRODUCT,
+	token.POWER:       POWER,
+	token.LPAREN:      CALL,
+	token.LSQUARE:     INDEX,
+	token.DOT:         INDEX,
+	token.QUESTION:    INDEX,
 }
 
 type (
@@ -39,10 +64,31 @@ type (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
-
-	curToken  token.Token
-	peekToken token.Token
+	errors []*ParseError
+	// panicking is set by the first error in a statement, further
+	// errors are dropped until the parser synchronized again
+	panicking  bool
+	blockDepth int
+	// curlyDepth counts the { minus the } up to and including curToken
+	curlyDepth int
+	// loopDepth counts the loops enclosing the current statement within
+	// the current function, break and continue are only valid inside one
+	loopDepth int
+	// functionDepth counts the functions enclosing the current expression,
+	// ? is only valid inside one
+	functionDepth int
+	// valueDepth counts the if and try expressions within the current
+	// loop whose value is used by an enclosing expression. break and
+	// continue cannot leave those, the values of the enclosing expression
+	// computed so far would be left behind.
+	valueDepth int
+	// statementStart is where the current expression statement starts
+	statementStart token.Position
+
+	prevToken  token.Token
+	curToken   token.Token
+	peekToken  token.Token
+	pushedBack []token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -51,16 +97,18 @@ type Parser struct {
 func New(l *lexer.Lexer) (p *Parser) {
 	p = &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.LSQUARE, p.parseArrayLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.LCURLY, p.parseHashLiteral)
@@ -68,6 +116,9 @@ func New(l *lexer.Lexer) (p *Parser) {
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -78,8 +129,23 @@ func New(l *lexer.Lexer) (p *Parser) {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LSQUARE, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseDotExpression)
+	p.registerInfix(token.QUESTION, p.parsePropagateExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -87,18 +153,73 @@ func New(l *lexer.Lexer) (p *Parser) {
 	return
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
 func (p *Parser) peekErrors(t token.TokenType) {
-	message := fmt.Sprintf("expected next token to be %s, got %s", t, p.peekToken.Type)
-	p.errors = append(p.errors, message)
+	err := p.addError(p.peekToken, "expected next token to be %s, got %s", t, p.peekToken.Type)
+	err.Expected = []token.TokenType{t}
+}
+
+// addError records a parser error spanning tok, unless it follows
+// another error in the same statement
+func (p *Parser) addError(tok token.Token, format string, a ...interface{}) *ParseError {
+	err := &ParseError{
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Actual:   tok.Type,
+	}
+	if !p.panicking {
+		p.errors = append(p.errors, err)
+		p.panicking = true
+	}
+	return err
+}
+
+// addWarning records a parser warning spanning node. Unlike errors,
+// warnings don't abandon the statement they are found in.
+func (p *Parser) addWarning(node ast.Node, format string, a ...interface{}) *ParseError {
+	warning := &ParseError{
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      node.Pos(),
+		End:      node.End(),
+	}
+	p.errors = append(p.errors, warning)
+	return warning
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	if n := len(p.pushedBack); n > 0 {
+		p.peekToken = p.pushedBack[n-1]
+		p.pushedBack = p.pushedBack[:n-1]
+	} else {
+		p.peekToken = p.l.NextToken()
+	}
+	p.curlyDepth += curlyDelta(p.curToken)
+}
+
+// backup undoes the last call to nextToken
+func (p *Parser) backup() {
+	p.curlyDepth -= curlyDelta(p.curToken)
+	p.pushedBack = append(p.pushedBack, p.peekToken)
+	p.peekToken = p.curToken
+	p.curToken = p.prevToken
+}
+
+func curlyDelta(tok token.Token) int {
+	switch tok.Type {
+	case token.LCURLY:
+		return 1
+	case token.RCURLY:
+		return -1
+	}
+	return 0
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -113,27 +234,118 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// parseStatement parses a single statement. If it contains syntax errors
+// the parser skips to the end of the statement and returns a BadStatement
+// instead, so every error is only reported once. The BadStatement keeps
+// what could be parsed of the statement.
 func (p *Parser) parseStatement() ast.Statement {
+	from := p.curToken
+	fromDepth := p.curlyDepth - curlyDelta(from)
+	errorCount := len(p.errors)
+	statement := p.parseStatementKind()
+
+	if p.panicking && len(p.errors) > errorCount {
+		p.synchronize(fromDepth)
+		p.panicking = false
+		return &ast.BadStatement{From: from, To: p.curToken, Partial: statement}
+	}
+	return statement
+}
+
+// synchronize advances to the last token of the current statement, that
+// is to the next ; or to the token before }, a statement keyword or EOF. Blocks
+// opened within the statement, which started at curlyDepth fromDepth,
+// are skipped as a whole.
+func (p *Parser) synchronize(fromDepth int) {
+	lastError := p.errors[len(p.errors)-1]
+	if p.curTokenIs(token.RCURLY) && p.blockDepth > 0 && lastError.Pos == p.curToken.Pos {
+		// the failing statement got stuck on the } closing its block
+		p.backup()
+		return
+	}
+
+	depth := p.curlyDepth - fromDepth
+	for !p.curTokenIs(token.EOF) {
+		if depth <= 0 {
+			if p.curTokenIs(token.SEMI) {
+				return
+			}
+			switch p.peekToken.Type {
+			case token.RCURLY, token.LET, token.CONST, token.RETURN, token.THROW, token.WHILE, token.FOR, token.IMPORT, token.EXPORT, token.EOF:
+				return
+			}
+		}
+		p.nextToken()
+		depth += curlyDelta(p.curToken)
+	}
+}
+
+// parseStatementKind parses a statement of the kind curToken starts. It
+// returns nil rather than a typed nil if the statement was given up on.
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		if statement := p.parseLetStatement(); statement != nil {
+			return statement
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if statement := p.parseReturnStatement(); statement != nil {
+			return statement
+		}
+	case token.THROW:
+		if statement := p.parseThrowStatement(); statement != nil {
+			return statement
+		}
+	case token.WHILE:
+		if statement := p.parseWhileStatement(); statement != nil {
+			return statement
+		}
+	case token.FOR:
+		if statement := p.parseForInStatement(); statement != nil {
+			return statement
+		}
+	case token.BREAK:
+		if statement := p.parseBreakStatement(); statement != nil {
+			return statement
+		}
+	case token.CONTINUE:
+		if statement := p.parseContinueStatement(); statement != nil {
+			return statement
+		}
+	case token.IMPORT:
+		if statement := p.parseImportStatement(); statement != nil {
+			return statement
+		}
+	case token.EXPORT:
+		if statement := p.parseExportStatement(); statement != nil {
+			return statement
+		}
 	default:
-		return p.parseExpressionStatement()
+		if statement := p.parseExpressionStatement(); statement != nil {
+			return statement
+		}
 	}
+	return nil
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	statement := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
-
-	statement.Name = &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
+	switch {
+	case !statement.IsConst() && (p.peekTokenIs(token.LSQUARE) || p.peekTokenIs(token.LCURLY)):
+		p.nextToken()
+		statement.Pattern = p.parsePattern()
+		if statement.Pattern == nil {
+			return nil
+		}
+	default:
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		statement.Name = &ast.Identifier{
+			Token: p.curToken,
+			Value: p.curToken.Literal,
+		}
 	}
 
 	if !p.expectPeek(token.ASSIGN) {
@@ -144,7 +356,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	statement.Value = p.parseExpression(LOWEST)
 
-	if fl, ok := statement.Value.(*ast.FunctionLiteral); ok {
+	if fl, ok := statement.Value.(*ast.FunctionLiteral); ok && statement.Name != nil {
 		fl.Name = statement.Name.Value
 	}
 
@@ -154,6 +366,129 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return statement
 }
 
+// parsePattern parses the target of a destructuring binding, starting
+// at its first token
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.LSQUARE:
+		return p.parseArrayPattern(p.parsePattern)
+	case token.LCURLY:
+		return p.parseHashPattern(p.parsePattern)
+	default:
+		err := p.addError(p.curToken, "expected pattern, got %s", p.curToken.Type)
+		err.Expected = []token.TokenType{token.IDENT, token.LSQUARE, token.LCURLY}
+		return nil
+	}
+}
+
+// parseArrayPattern and parseHashPattern parse their nested patterns
+// with element, so match arms can nest literal patterns
+func (p *Parser) parseArrayPattern(element func() ast.Pattern) ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RSQUARE) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			// the rest has to come last
+			break
+		}
+
+		el := element()
+		if el == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, el)
+
+		if !p.peekTokenIs(token.RSQUARE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RSQUARE) {
+		return nil
+	}
+	pattern.Rsquare = p.curToken
+	return pattern
+}
+
+func (p *Parser) parseHashPattern(element func() ast.Pattern) ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RCURLY) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		key := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		var value ast.Pattern = key
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			value = element()
+			if value == nil {
+				return nil
+			}
+		}
+		pattern.Keys = append(pattern.Keys, key)
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.RCURLY) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RCURLY) {
+		return nil
+	}
+	pattern.Rcurly = p.curToken
+	return pattern
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	statement := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	statement.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMI) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	statement := &ast.ExportStatement{Token: p.curToken}
+
+	if p.blockDepth > 0 {
+		p.addError(p.curToken, "export is only allowed at the top level")
+		return nil
+	}
+	if p.peekTokenIs(token.CONST) {
+		p.nextToken()
+	} else if !p.expectPeek(token.LET) {
+		return nil
+	}
+	statement.Let = p.parseLetStatement()
+	if statement.Let == nil {
+		return nil
+	}
+	return statement
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	statement := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
@@ -166,9 +501,129 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	statement := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+
+	statement.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMI) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	statement := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	statement.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+	statement.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMI) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseForInStatement() *ast.ForInStatement {
+	statement := &ast.ForInStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	statement.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	statement.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+	statement.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMI) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	outerValueDepth := p.valueDepth
+	p.loopDepth += 1
+	p.valueDepth = 0
+	defer func() {
+		p.loopDepth -= 1
+		p.valueDepth = outerValueDepth
+	}()
+	return p.parseBlockStatement()
+}
+
+// enterValue counts the if or try expression at curToken in valueDepth,
+// unless it is a statement of its own, and returns the function that
+// leaves it again
+func (p *Parser) enterValue() func() {
+	if p.curToken.Pos == p.statementStart {
+		return func() {}
+	}
+	p.valueDepth += 1
+	return func() { p.valueDepth -= 1 }
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	statement := &ast.BreakStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.addError(p.curToken, "break outside of loop")
+		return nil
+	}
+	if p.valueDepth > 0 {
+		p.addError(p.curToken, "break inside an expression")
+		return nil
+	}
+	if p.peekTokenIs(token.SEMI) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	statement := &ast.ContinueStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.addError(p.curToken, "continue outside of loop")
+		return nil
+	}
+	if p.valueDepth > 0 {
+		p.addError(p.curToken, "continue inside an expression")
+		return nil
+	}
+	if p.peekTokenIs(token.SEMI) {
+		p.nextToken()
+	}
+	return statement
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	defer untrace(trace("parseExpressionStatement"))
 	statement := &ast.ExpressionStatement{Token: p.curToken}
+	p.statementStart = p.curToken.Pos
 
 	statement.Expression = p.parseExpression(LOWEST)
 
@@ -182,12 +637,12 @@ func (p *Parser) parseExpression(precedence uint) ast.Expression {
 	defer untrace(trace("parseExpression"))
 	prefix, ok := p.prefixParseFns[p.curToken.Type]
 	if !ok {
-		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		p.noPrefixParseFnError(p.curToken)
+		return &ast.BadExpression{Token: p.curToken}
 	}
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMI) && precedence < p.peekPrecedence() {
+	for !p.peekTokenIs(token.SEMI) && precedence < p.peekPrecedence() && !p.panicking {
 		infix, ok := p.infixParseFns[p.peekToken.Type]
 		if !ok {
 			return leftExp
@@ -219,15 +674,67 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if p.curTokenIs(token.POWER) {
+		// ** is right associative: 2 ** 3 ** 2 == 2 ** (3 ** 2)
+		precedence -= 1
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
-func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	message := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, message)
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.curToken, Target: target}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.addError(p.curToken, "cannot assign to %s", target)
+		return nil
+	}
+
+	p.nextToken()
+	// assignment is right associative: a = b = 1 assigns 1 to both
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
+// parsePipeExpression desugars x |> f(a) to the call f(x, a) and x |> f
+// to f(x), so the evaluator and compiler only ever see plain calls. In
+// x |> obj.m(a) x becomes the first argument after the receiver, the
+// call is obj.m(x, a).
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	pipe := p.curToken
+	precedence := p.curPrecedence()
+	p.nextToken()
+	right := p.parseExpression(precedence)
+
+	if call, ok := right.(*ast.CallExpression); ok {
+		call.Arguments = append([]ast.Expression{left}, call.Arguments...)
+		return call
+	}
+	if call, ok := right.(*ast.MethodCallExpression); ok {
+		call.Arguments = append([]ast.Expression{left}, call.Arguments...)
+		return call
+	}
+	// without parentheses the call ends where the function expression does
+	return &ast.CallExpression{
+		Token:     pipe,
+		Function:  right,
+		Arguments: []ast.Expression{left},
+		Rparen:    p.curToken,
+	}
+}
+
+func (p *Parser) noPrefixParseFnError(t token.Token) {
+	p.addError(t, "no prefix parse function for %s found", t.Type)
+}
+
+// parseIllegal reports the diagnostic the lexer stored in an ILLEGAL token
+func (p *Parser) parseIllegal() ast.Expression {
+	p.addError(p.curToken, "%s", p.curToken.Literal)
+	return &ast.BadExpression{Token: p.curToken}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -239,9 +746,28 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		p.addError(p.curToken, "integer literal %s overflows int64", p.curToken.Literal)
+		return nil
+	}
 	if err != nil {
-		message := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, message)
+		p.addError(p.curToken, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		p.addError(p.curToken, "float literal %s out of range", p.curToken.Literal)
+		return nil
+	}
+	if err != nil {
+		p.addError(p.curToken, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -265,6 +791,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
+	defer p.enterValue()()
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
@@ -291,9 +818,140 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+	defer p.enterValue()()
+
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if !p.peekTokenIs(token.CATCH) && !p.peekTokenIs(token.FINALLY) {
+		err := p.addError(p.peekToken, "expected next token to be %s or %s, got %s",
+			token.CATCH, token.FINALLY, p.peekToken.Type)
+		err.Expected = []token.TokenType{token.CATCH, token.FINALLY}
+		return nil
+	}
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.expectPeek(token.LCURLY) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LCURLY) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+	return expression
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+
+	exhaustive := false
+	for !p.peekTokenIs(token.RCURLY) {
+		p.nextToken()
+		arm := &ast.MatchArm{Pattern: p.parseMatchPattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+		arm.Body = p.parseExpression(LOWEST)
+		expression.Arms = append(expression.Arms, arm)
+
+		if _, ok := arm.Pattern.(*ast.Identifier); ok && arm.Guard == nil {
+			exhaustive = true
+		}
+		if !p.peekTokenIs(token.RCURLY) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RCURLY) {
+		return nil
+	}
+	expression.Rcurly = p.curToken
+
+	if !exhaustive {
+		p.addWarning(expression, "no arm matches every value, add a _ arm to handle the rest")
+	}
+	return expression
+}
+
+// parseMatchPattern parses the pattern of a match arm, which unlike
+// a let pattern may contain literals
+func (p *Parser) parseMatchPattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.LSQUARE:
+		return p.parseArrayPattern(p.parseMatchPattern)
+	case token.LCURLY:
+		return p.parseHashPattern(p.parseMatchPattern)
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE:
+		value := p.prefixParseFns[p.curToken.Type]()
+		if value == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Value: value}
+	case token.MINUS:
+		if !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) {
+			err := p.addError(p.peekToken, "expected number after -, got %s", p.peekToken.Type)
+			err.Expected = []token.TokenType{token.INT, token.FLOAT}
+			return nil
+		}
+		value := p.parsePrefixExpression()
+		if value.(*ast.PrefixExpression).Right == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Value: value}
+	default:
+		err := p.addError(p.curToken, "expected pattern, got %s", p.curToken.Type)
+		err.Expected = []token.TokenType{token.IDENT, token.LSQUARE, token.LCURLY, token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE}
+		return nil
+	}
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.blockDepth += 1
+	defer func() { p.blockDepth -= 1 }()
 
 	p.nextToken()
 
@@ -302,6 +960,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		block.Statements = append(block.Statements, statement)
 		p.nextToken()
 	}
+	block.Rcurly = p.curToken
 	return block
 }
 
@@ -311,55 +970,179 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	lit.Parameters = p.parseFunctionParameters()
+	params := p.parseFunctionParameters()
+	if params == nil {
+		return nil
+	}
+	lit.Parameters = params.identifiers
+	lit.Defaults = params.defaults
+	lit.Rest = params.rest
 
 	if !p.expectPeek(token.LCURLY) {
 		return nil
 	}
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
+	lit.Body.Statements = append(params.destructuring, lit.Body.Statements...)
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseFunctionBody parses the body of a function or macro, a loop
+// around the literal does not extend into it
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
+	p.functionDepth += 1
+	defer func() {
+		p.loopDepth = outerLoopDepth
+		p.functionDepth -= 1
+	}()
+	return p.parseBlockStatement()
+}
+
+// parameterList is a parsed parameter list. A parameter that is a
+// pattern is replaced by a hidden parameter, the let statements in
+// destructuring destructure those and belong at the start of the body.
+type parameterList struct {
+	identifiers   []*ast.Identifier
+	defaults      []ast.Expression
+	rest          *ast.Identifier
+	destructuring []ast.Statement
+}
+
+func (p *Parser) parseFunctionParameters() *parameterList {
+	params := &parameterList{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return params
 	}
-	p.nextToken()
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+	hasDefaults := false
+	for {
 		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			// the rest parameter has to come last
+			params.rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		if p.curTokenIs(token.LSQUARE) || p.curTokenIs(token.LCURLY) {
+			pattern := p.parsePattern()
+			if pattern == nil {
+				return nil
+			}
+			// "$" keeps the hidden name from clashing with any identifier
+			name := fmt.Sprintf("$%d", len(params.identifiers))
+			ident = &ast.Identifier{
+				Token: token.Token{Type: token.IDENT, Literal: name, Pos: pattern.Pos(), End: pattern.End()},
+				Value: name,
+			}
+			params.destructuring = append(params.destructuring, &ast.LetStatement{
+				Token:   token.Token{Type: token.LET, Literal: "let", Pos: pattern.Pos(), End: pattern.Pos()},
+				Pattern: pattern,
+				Value:   ident,
+			})
+		}
+
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			def = p.parseExpression(LOWEST)
+			hasDefaults = true
+		} else if hasDefaults {
+			p.addError(p.curToken, "parameter %s without default follows parameter with default", ident)
+			return nil
+		}
+		params.identifiers = append(params.identifiers, ident)
+		params.defaults = append(params.defaults, def)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	return identifiers
+	if !hasDefaults {
+		params.defaults = nil
+	}
+	return params
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.curToken
 	return exp
 }
 
+// parseIndexExpression parses left[index] as well as the slices
+// left[low:high], left[:high] and left[low:]
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	lsquare := p.curToken
 
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	var index ast.Expression
+	if !p.curTokenIs(token.COLON) {
+		index = p.parseExpression(LOWEST)
+		if !p.peekTokenIs(token.COLON) {
+			if !p.expectPeek(token.RSQUARE) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: lsquare, Left: left, Index: index, Rsquare: p.curToken}
+		}
+		p.nextToken()
+	}
 
+	slice := &ast.SliceExpression{Token: lsquare, Left: left, Low: index}
+	if !p.peekTokenIs(token.RSQUARE) {
+		p.nextToken()
+		slice.High = p.parseExpression(LOWEST)
+	}
 	if !p.expectPeek(token.RSQUARE) {
 		return nil
 	}
-	return exp
+	slice.Rsquare = p.curToken
+	return slice
+}
+
+func (p *Parser) parsePropagateExpression(value ast.Expression) ast.Expression {
+	if p.functionDepth == 0 {
+		p.addError(p.curToken, "? outside of function")
+		return nil
+	}
+	return &ast.PropagateExpression{Token: p.curToken, Value: value}
+}
+
+// parseDotExpression parses value.field, which is sugar for
+// value["field"], and the method call value.method(args)
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	dot := p.curToken
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		exp := &ast.MethodCallExpression{Token: dot, Receiver: left, Method: name}
+		exp.Arguments = p.parseExpressionList(token.RPAREN)
+		exp.Rparen = p.curToken
+		return exp
+	}
+	return &ast.IndexExpression{
+		Token:   dot,
+		Left:    left,
+		Index:   &ast.StringLiteral{Token: name.Token, Value: name.Value},
+		Rsquare: name.Token,
+	}
 }
 
 func (p *Parser) parseExpressionList(end token.TokenType) (list []ast.Expression) {
@@ -368,20 +1151,32 @@ func (p *Parser) parseExpressionList(end token.TokenType) (list []ast.Expression
 		return
 	}
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
 
-	if !p.expectPeek(end) {
-		return nil
-	}
+	// on a missing end the elements parsed so far are kept, for the
+	// partial statement of the BadStatement
+	p.expectPeek(end)
 	return
 }
 
+// parseListElement parses an element of an array literal or argument
+// list, which may spread an array with ...
+func (p *Parser) parseListElement() ast.Expression {
+	if p.curTokenIs(token.ELLIPSIS) {
+		spread := &ast.SpreadExpression{Token: p.curToken}
+		p.nextToken()
+		spread.Value = p.parseExpression(LOWEST)
+		return spread
+	}
+	return p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -390,6 +1185,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RSQUARE)
+	array.Rsquare = p.curToken
 
 	return array
 }
@@ -418,6 +1214,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RCURLY) {
 		return nil
 	}
+	hash.Rcurly = p.curToken
 	return hash
 }
 
@@ -427,12 +1224,21 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	lit.Parameters = p.parseFunctionParameters()
+	params := p.parseFunctionParameters()
+	if params == nil {
+		return nil
+	}
+	if params.defaults != nil || params.rest != nil {
+		p.addError(lit.Token, "macro parameters cannot have defaults or a rest parameter")
+		return nil
+	}
+	lit.Parameters = params.identifiers
 
 	if !p.expectPeek(token.LCURLY) {
 		return nil
 	}
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
+	lit.Body.Statements = append(params.destructuring, lit.Body.Statements...)
 	return lit
 }
 
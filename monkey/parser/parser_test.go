@@ -1,9 +1,12 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
 	"testing"
 )
 
@@ -139,6 +142,92 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF;", 255},
+		{"0o755;", 493},
+		{"0b1010;", 10},
+		{"1_000_000;", 1000000},
+		{"0x_dead_beef;", 0xdeadbeef},
+		{"9223372036854775807;", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestInvalidIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "1:1: integer literal 9223372036854775808 overflows int64"},
+		{"0xFFFFFFFFFFFFFFFFF", "1:1: integer literal 0xFFFFFFFFFFFFFFFFF overflows int64"},
+		{"0b102", `1:1: could not parse "0b102" as integer`},
+		{"0x", `1:1: could not parse "0x" as integer`},
+		{"1__000", `1:1: could not parse "1__000" as integer`},
+		{"1e999", "1:1: float literal 1e999 out of range"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0].Error() != tt.expected {
+			t.Errorf("wrong parser errors for %q. expected [%q], got %q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E+3;", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -151,6 +240,7 @@ func TestPrefixExpressions(t *testing.T) {
 		{"-foobar;", "-", "foobar"},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		{"~5;", "~", 5},
 	}
 
 	for _, tt := range prefixTests {
@@ -197,6 +287,10 @@ func TestInfixExpressions(t *testing.T) {
 		{"5 / 5;", 5, "/", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
@@ -305,6 +399,42 @@ func TestOperatorPrecedence(t *testing.T) {
 			"3 < 5 == true",
 			"((3 < 5) == true)",
 		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"2 ** 3 ** 2 * 4",
+			"((2 ** (3 ** 2)) * 4)",
+		},
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"a | b ^ c & d << e + f",
+			"(a | (b ^ (c & (d << (e + f)))))",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"~a >> 1",
+			"((~a) >> 1)",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a && b || !c && d",
+			"((a && b) || ((!c) && d))",
+		},
+		{
+			"1 + 2 <= 3 == 4 >= 5",
+			"(((1 + 2) <= 3) == (4 >= 5))",
+		},
 		{
 			"1 + (2 + 3) + 4",
 			"((1 + (2 + 3)) + 4)",
@@ -349,6 +479,54 @@ func TestOperatorPrecedence(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a = b || c",
+			"(a = (b || c))",
+		},
+		{
+			"a = b = c + 1",
+			"(a = (b = (c + 1)))",
+		},
+		{
+			"xs |> filter(f) |> map(g) |> sum",
+			"sum(map(filter(xs, f), g))",
+		},
+		{
+			"a + 1 |> f == b | c |> g",
+			"(f((a + 1)) == g((b | c)))",
+		},
+		{
+			"x = y |> fn(v) { v }",
+			"(x = fn(v)v(y))",
+		},
+		{
+			"a[i + 1] = f(x)[0]",
+			"((a[(i + 1)]) = (f(x)[0]))",
+		},
+		{
+			"a[1:2] + s[:-1][i:]",
+			"((a[1:2]) + ((s[:(-1)])[i:]))",
+		},
+		{
+			"a[:]",
+			"(a[:])",
+		},
+		{
+			"-a.b.c * 2",
+			"((-((a[b])[c])) * 2)",
+		},
+		{
+			"a.b(c).d[0]",
+			"((a.b(c)[d])[0])",
+		},
+		{
+			"h.count = h.count + 1",
+			"((h[count]) = ((h[count]) + 1))",
+		},
+		{
+			"s |> str.split(\",\") |> len",
+			"len(str.split(s, ,))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -586,6 +764,63 @@ func TestFunctionParameter(t *testing.T) {
 	}
 }
 
+func TestFunctionParameterDefaultsAndRest(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 10) {}", "fn(a, b = 10)"},
+		{"fn(a = 1, b = a * 2) {}", "fn(a = 1, b = (a * 2))"},
+		{"fn(...rest) {}", "fn(...rest)"},
+		{"fn(a, b = 1, ...rest) {}", "fn(a, b = 1, ...rest)"},
+		{"fn([a, b] = [1, 2]) { a }", "fn($0 = [1, 2])let [a, b] = $0;a"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+		if function.String() != test.expected {
+			t.Errorf("expected=%q, got=%q", test.expected, function.String())
+		}
+	}
+}
+
+func TestInvalidParameterLists(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn(a = 1, b) {}", "1:11: parameter b without default follows parameter with default"},
+		{"fn(...a, b) {}", "1:8: expected next token to be ), got ,"},
+		{"fn(...) {}", "1:7: expected next token to be IDENT, got )"},
+		{"macro(a, ...b) { a }", "1:1: macro parameters cannot have defaults or a rest parameter"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. expected 1, got %d: %v",
+				test.input, len(errors), errors)
+			continue
+		}
+		if errors[0].Error() != test.expectedError {
+			t.Errorf("wrong error for %q. expected %q, got %q", test.input, test.expectedError, errors[0])
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -1033,3 +1268,1020 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5;", "1:5: expected next token to be IDENT, got ="},
+		{"let x = 5;\nlet y 7;", "2:7: expected next token to be =, got INT"},
+		{"\n  ;", "2:3: no prefix parse function for ; found"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", test.input)
+		}
+		if errors[0].Error() != test.expected {
+			t.Errorf("wrong error. expected %q, got %q", test.expected, errors[0])
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1, [2, 3][0]);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node      ast.Node
+		startLine int
+		startCol  int
+		endLine   int
+		endCol    int
+	}{
+		{program, 1, 1, 4, 18},
+		{program.Statements[0], 1, 1, 3, 2},
+		{program.Statements[0].(*ast.LetStatement).Value, 1, 11, 3, 2},
+		{program.Statements[1], 4, 1, 4, 18},
+	}
+
+	for i, test := range tests {
+		pos, end := test.node.Pos(), test.node.End()
+		if pos.Line != test.startLine || pos.Column != test.startCol {
+			t.Errorf("tests[%d] - wrong start. expected %d:%d, got %s", i, test.startLine, test.startCol, pos)
+		}
+		if end.Line != test.endLine || end.Column != test.endCol {
+			t.Errorf("tests[%d] - wrong end. expected %d:%d, got %s", i, test.endLine, test.endCol, end)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `
+	// a line comment
+	let x = 5; /* a block
+	comment */ x;
+	`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	if !testLetStatement(t, program.Statements[0], "x") {
+		return
+	}
+
+	l = lexer.New("let x = 5; /* never closed")
+	p = New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	expected := "1:12: unterminated block comment starting at line 1"
+	if len(errors) != 1 || errors[0].Error() != expected {
+		t.Errorf("wrong parser errors. expected [%q], got %q", expected, errors)
+	}
+}
+
+func TestParseErrorFields(t *testing.T) {
+	l := lexer.New("let x 5;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	err := errors[0]
+	if err.Severity != SeverityError {
+		t.Errorf("wrong severity. expected %s, got %s", SeverityError, err.Severity)
+	}
+	if err.Message != "expected next token to be =, got INT" {
+		t.Errorf("wrong message. got %q", err.Message)
+	}
+	if err.Pos.Offset != 6 || err.End.Offset != 7 {
+		t.Errorf("wrong span. expected 6-7, got %d-%d", err.Pos.Offset, err.End.Offset)
+	}
+	if len(err.Expected) != 1 || err.Expected[0] != token.ASSIGN {
+		t.Errorf("wrong expected tokens. got %v", err.Expected)
+	}
+	if err.Actual != token.INT {
+		t.Errorf("wrong actual token. expected %s, got %s", token.INT, err.Actual)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 5;\n\tlet y 77;",
+			"2:8: error: expected next token to be =, got INT\n\tlet y 77;\n\t      ^^\n",
+		},
+		{
+			"let größe 1;",
+			"1:11: error: expected next token to be =, got INT\nlet größe 1;\n          ^\n",
+		},
+		{
+			"let x = 1 +",
+			"1:12: error: no prefix parse function for EOF found\nlet x = 1 +\n           ^\n",
+		},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		var out bytes.Buffer
+		Render(&out, test.input, p.Errors()[0])
+		if out.String() != test.expected {
+			t.Errorf("wrong rendering. expected\n%s\ngot\n%s", test.expected, out.String())
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	l := lexer.NewWithFile("test.monkey", "let = 5;")
+	p := New(l)
+	p.ParseProgram()
+
+	var out bytes.Buffer
+	err := WriteJSON(&out, p.Errors()[:1])
+	if err != nil {
+		t.Fatalf("WriteJSON failed: %s", err)
+	}
+
+	var decoded []map[string]interface{}
+	err = json.Unmarshal(out.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, out.String())
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(decoded))
+	}
+	diag := decoded[0]
+	if diag["severity"] != "error" || diag["actual"] != "=" {
+		t.Errorf("wrong severity or actual token. got %v", diag)
+	}
+	pos := diag["pos"].(map[string]interface{})
+	if pos["file"] != "test.monkey" || pos["line"] != 1.0 || pos["column"] != 5.0 {
+		t.Errorf("wrong position. got %v", pos)
+	}
+	expected := diag["expected"].([]interface{})
+	if len(expected) != 1 || expected[0] != "IDENT" {
+		t.Errorf("wrong expected tokens. got %v", expected)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expectedAST    string
+	}{
+		{
+			"let x 5; let y = 2; let = 3; z;",
+			[]string{
+				"1:7: expected next token to be =, got INT",
+				"1:25: expected next token to be IDENT, got =",
+			},
+			"<bad statement>let y = 2;<bad statement>z",
+		},
+		{
+			"let f = fn(a) { a + }; f(1);",
+			[]string{"1:21: no prefix parse function for } found"},
+			"let f = fn f(a)<bad statement>f(1);",
+		},
+		{
+			"let f = fn(a) { let b 1; b }; let c = 1 +; c",
+			[]string{
+				"1:23: expected next token to be =, got INT",
+				"1:42: no prefix parse function for ; found",
+			},
+			"let f = fn f(a)<bad statement>b;<bad statement>c",
+		},
+		{
+			"if (a b) { c } let d = 1;",
+			[]string{"1:7: expected next token to be ), got IDENT"},
+			"<bad statement>let d = 1;",
+		},
+		{
+			"let h = {1 2}; let q = 1;",
+			[]string{"1:12: expected next token to be :, got INT"},
+			"<bad statement>let q = 1;",
+		},
+		{
+			"f(1 +, 2); let q = 1;",
+			[]string{"1:6: no prefix parse function for , found"},
+			"<bad statement>let q = 1;",
+		},
+		{
+			"} let a = 1;\nreturn [1, 2;\nx",
+			[]string{
+				"1:1: no prefix parse function for } found",
+				"2:13: expected next token to be ], got ;",
+			},
+			"<bad statement>let a = 1;<bad statement>x",
+		},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(test.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected %d, got %d: %v",
+				test.input, len(test.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, expected := range test.expectedErrors {
+			if errors[i].Error() != expected {
+				t.Errorf("wrong error for %q. expected %q, got %q", test.input, expected, errors[i])
+			}
+		}
+		if program.String() != test.expectedAST {
+			t.Errorf("wrong AST for %q. expected %q, got %q", test.input, test.expectedAST, program.String())
+		}
+	}
+}
+
+func TestBadStatementSpan(t *testing.T) {
+	l := lexer.New("let x 5;\nlet y = 1;")
+	p := New(l)
+	program := p.ParseProgram()
+
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.BadStatement. got %T", program.Statements[0])
+	}
+	if bad.Pos().Offset != 0 || bad.End().Offset != 8 {
+		t.Errorf("wrong span. expected 0-8, got %d-%d", bad.Pos().Offset, bad.End().Offset)
+	}
+	if !testLetStatement(t, program.Statements[1], "y") {
+		return
+	}
+}
+
+func TestBadStatementPartial(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 + ;", "let x = (1 + <bad expression>);"},
+		{"f(1, ;", "f(1, <bad expression>)"},
+		{"return [1, 2;", "return [1, 2];"},
+		{"let x 5;", ""},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		bad, ok := program.Statements[0].(*ast.BadStatement)
+		if !ok {
+			t.Fatalf("statement is not *ast.BadStatement. got %T", program.Statements[0])
+		}
+		partial := ""
+		if bad.Partial != nil {
+			partial = bad.Partial.String()
+		}
+		if partial != test.expected {
+			t.Errorf("wrong partial statement for %q. expected %q, got %q", test.input, test.expected, partial)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; break; continue; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("Statements[1] is not ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	input := `for (x in [1, 2]) { if (x) { break } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ForInStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if stmt.Iterable.String() != "[1, 2]" {
+		t.Errorf("wrong iterable. expected %q, got %q", "[1, 2]", stmt.Iterable.String())
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+}
+
+func TestLoopTrailingSemicolon(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedLoop  string
+		expectedValue string
+	}{
+		{"while (i < 2) { i = i + 1 }; i", "while", "i"},
+		{"for (x in [1]) { }; 1", "for", "1"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 2 {
+			t.Fatalf("program.Statements does not contain 2 statements. got=%d\n",
+				len(program.Statements))
+		}
+		if program.Statements[0].TokenLiteral() != test.expectedLoop {
+			t.Errorf("Statements[0] is not a %s loop. got=%T", test.expectedLoop, program.Statements[0])
+		}
+		if program.Statements[1].String() != test.expectedValue {
+			t.Errorf("Statements[1] is not %q. got=%q", test.expectedValue, program.Statements[1].String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"break;", "1:1: break outside of loop"},
+		{"if (x) { continue }", "1:10: continue outside of loop"},
+		{"while (x) { let f = fn() { break; }; }", "1:28: break outside of loop"},
+		{"for (x in [1, 2]) { r = push(r, if (x == 1) { continue; } else { x }); }", "1:47: continue inside an expression"},
+		{"while (n < 3) { let y = if (true) { break; }; }", "1:37: break inside an expression"},
+		{"while (true) { let y = [1, if (true) { break; }]; }", "1:40: break inside an expression"},
+		{"while (true) { 1 + try { break } finally { 2 } }", "1:26: break inside an expression"},
+		{"while (true) { if (x) { let y = if (x) { 1 } else { continue } } }", "1:53: continue inside an expression"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. expected 1, got %d: %v",
+				test.input, len(errors), errors)
+			continue
+		}
+		if errors[0].Error() != test.expectedError {
+			t.Errorf("wrong error for %q. expected %q, got %q", test.input, test.expectedError, errors[0])
+		}
+	}
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"1 = 2", "1:3: cannot assign to 1"},
+		{"a + b = c", "1:7: cannot assign to (a + b)"},
+		{"f() = 1", "1:5: cannot assign to f()"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. expected 1, got %d: %v",
+				test.input, len(errors), errors)
+			continue
+		}
+		if errors[0].Error() != test.expectedError {
+			t.Errorf("wrong error for %q. expected %q, got %q", test.input, test.expectedError, errors[0])
+		}
+	}
+}
+
+func TestPipeExpressionSpan(t *testing.T) {
+	input := "xs |> f(a) |> g"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, call.Function, "g") {
+		return
+	}
+	if len(call.Arguments) != 1 || call.Arguments[0].String() != "f(xs, a)" {
+		t.Fatalf("wrong arguments. got=%v", call.Arguments)
+	}
+	if call.End().Offset != len(input) {
+		t.Errorf("wrong end offset. expected %d, got %d", len(input), call.End().Offset)
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = x;", "let [a, b] = x;"},
+		{"let [a, [b, c], ...rest] = x;", "let [a, [b, c], ...rest] = x;"},
+		{"let [...all] = x;", "let [...all] = x;"},
+		{"let [] = x;", "let [] = x;"},
+		{"let {name, age} = person;", "let {name, age} = person;"},
+		{"let {name: n, tags: [first, ...more]} = x;", "let {name: n, tags: [first, ...more]} = x;"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("statement is not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Pattern == nil || stmt.Name != nil {
+			t.Errorf("expected a pattern and no name for %q", test.input)
+		}
+		if stmt.String() != test.expected {
+			t.Errorf("expected=%q, got=%q", test.expected, stmt.String())
+		}
+	}
+}
+
+func TestDestructuringParameters(t *testing.T) {
+	input := `fn(a, [b, c], {d}) { a }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.Parameters) != 3 {
+		t.Fatalf("function literal parameters wrong. want 3, got=%d\n", len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0], "a")
+	testLiteralExpression(t, function.Parameters[1], "$1")
+	testLiteralExpression(t, function.Parameters[2], "$2")
+
+	expectedBody := "let [b, c] = $1;let {d} = $2;a"
+	if function.Body.String() != expectedBody {
+		t.Errorf("wrong body. expected=%q, got=%q", expectedBody, function.Body.String())
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let [a, 1] = x;", "1:9: expected pattern, got INT"},
+		{"let [...a, b] = x;", "1:10: expected next token to be ], got ,"},
+		{"let {\"a\"} = x;", "1:6: expected next token to be IDENT, got STRING"},
+		{"fn([a b]) { a }", "1:7: expected next token to be ,, got IDENT"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. expected 1, got %d: %v",
+				test.input, len(errors), errors)
+			continue
+		}
+		if errors[0].Error() != test.expectedError {
+			t.Errorf("wrong error for %q. expected %q, got %q", test.input, test.expectedError, errors[0])
+		}
+	}
+}
+
+func TestSpreadExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[...a, 1, ...b]", "[...a, 1, ...b]"},
+		{"f(...args)", "f(...args)"},
+		{"f(a, ...g(b) + c)", "f(a, ...(g(b) + c))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	l := lexer.New("...a")
+	p := New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for a spread outside of a list")
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) { 1 => a, -2.5 => b, [h, ...t] if h > 0 => h, {kind: "click", pos: [_, y]} => y, _ => c }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	match, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, match.Subject, "x") {
+		return
+	}
+	expectedArms := []string{
+		"1 => a",
+		"(-2.5) => b",
+		"[h, ...t] if (h > 0) => h",
+		"{kind: click, pos: [_, y]} => y",
+		"_ => c",
+	}
+	if len(match.Arms) != len(expectedArms) {
+		t.Fatalf("wrong number of arms. expected %d, got %d", len(expectedArms), len(match.Arms))
+	}
+	for i, arm := range match.Arms {
+		if arm.String() != expectedArms[i] {
+			t.Errorf("arms[%d] wrong. expected %q, got %q", i, expectedArms[i], arm.String())
+		}
+	}
+	if _, ok := match.Arms[0].Pattern.(*ast.LiteralPattern); !ok {
+		t.Errorf("arms[0].Pattern is not ast.LiteralPattern. got=%T", match.Arms[0].Pattern)
+	}
+	if match.End().Offset != len(input) {
+		t.Errorf("wrong end offset. expected %d, got %d", len(input), match.End().Offset)
+	}
+}
+
+func TestMatchWithoutCatchAllWarns(t *testing.T) {
+	tests := []struct {
+		input    string
+		warnings int
+	}{
+		{"match (x) { 1 => 2, _ => 3 }", 0},
+		{"match (x) { [a] => a, other => other }", 0},
+		{"match (x) { 1 => 2 }", 1},
+		{"match (x) { n if n > 1 => 2 }", 1},
+		{"match (x) { }", 1},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if HasErrors(errors) {
+			t.Fatalf("unexpected errors for %q: %v", test.input, errors)
+		}
+		if len(errors) != test.warnings {
+			t.Errorf("wrong number of warnings for %q. expected %d, got %d",
+				test.input, test.warnings, len(errors))
+			continue
+		}
+		if test.warnings == 0 {
+			continue
+		}
+		warning := errors[0]
+		if warning.Severity != SeverityWarning {
+			t.Errorf("wrong severity. expected %s, got %s", SeverityWarning, warning.Severity)
+		}
+		expected := "1:1: no arm matches every value, add a _ arm to handle the rest"
+		if warning.Error() != expected {
+			t.Errorf("wrong warning. expected %q, got %q", expected, warning.Error())
+		}
+		if warning.End.Offset != len(test.input) {
+			t.Errorf("wrong end offset. expected %d, got %d", len(test.input), warning.End.Offset)
+		}
+	}
+}
+
+func TestInvalidMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"match (x) { 1 2 }", "1:15: expected next token to be =>, got INT"},
+		{"match (x) { fn => 1 }", "1:13: expected pattern, got FUNCTION"},
+		{"match (x) { -a => 1 }", "1:14: expected number after -, got IDENT"},
+		{"match (x) { 1 => 2 3 => 4 }", "1:20: expected next token to be ,, got INT"},
+		{"match x { _ => 1 }", "1:7: expected next token to be (, got IDENT"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. expected 1, got %d: %v",
+				test.input, len(errors), errors)
+			continue
+		}
+		if errors[0].Error() != test.expectedError {
+			t.Errorf("wrong error for %q. expected %q, got %q", test.input, test.expectedError, errors[0])
+		}
+	}
+}
+
+func TestDotExpressions(t *testing.T) {
+	input := `h.name; s.split(",", ...rest)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	index, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, index.Left, "h") {
+		return
+	}
+	key, ok := index.Index.(*ast.StringLiteral)
+	if !ok || key.Value != "name" {
+		t.Fatalf("index.Index is not the string name. got=%s", index.Index)
+	}
+	if index.End().Offset != len("h.name") {
+		t.Errorf("wrong end offset. expected %d, got %d", len("h.name"), index.End().Offset)
+	}
+
+	stmt = program.Statements[1].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.MethodCallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MethodCallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, call.Receiver, "s") || !testIdentifier(t, call.Method, "split") {
+		return
+	}
+	if len(call.Arguments) != 2 {
+		t.Fatalf("wrong number of arguments. expected 2, got %d", len(call.Arguments))
+	}
+	if _, ok := call.Arguments[1].(*ast.SpreadExpression); !ok {
+		t.Errorf("call.Arguments[1] is not ast.SpreadExpression. got=%T", call.Arguments[1])
+	}
+	if call.Pos().Offset != len("h.name; ") || call.End().Offset != len(input) {
+		t.Errorf("wrong span. got %d to %d", call.Pos().Offset, call.End().Offset)
+	}
+
+	l = lexer.New("a.1")
+	p = New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	expected := "1:3: expected next token to be IDENT, got INT"
+	if len(errors) != 1 || errors[0].Error() != expected {
+		t.Errorf("wrong errors. expected %q, got %v", expected, errors)
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		low   interface{}
+		high  interface{}
+	}{
+		{"a[1:2]", 1, 2},
+		{"a[:2]", nil, 2},
+		{"a[1:]", 1, nil},
+		{"a[:]", nil, nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.SliceExpression. got=%T", stmt.Expression)
+		}
+		if !testIdentifier(t, slice.Left, "a") {
+			return
+		}
+		for _, bound := range []struct {
+			exp      ast.Expression
+			expected interface{}
+		}{{slice.Low, tt.low}, {slice.High, tt.high}} {
+			if bound.expected == nil {
+				if bound.exp != nil {
+					t.Errorf("bound of %q should be left out. got=%s", tt.input, bound.exp)
+				}
+				continue
+			}
+			testLiteralExpression(t, bound.exp, bound.expected)
+		}
+		if slice.End().Offset != len(tt.input) {
+			t.Errorf("wrong end offset. expected %d, got %d", len(tt.input), slice.End().Offset)
+		}
+	}
+}
+
+func TestImportExportStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/strings.monkey" as s`, `import "lib/strings.monkey" as s;`},
+		{`export let x = 1`, `export let x = 1;`},
+		{`export let [a, ...rest] = xs`, `export let [a, ...rest] = xs;`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+		if end := program.Statements[0].End().Offset; end != len(tt.input) {
+			t.Errorf("wrong end offset for %q. expected %d, got %d", tt.input, len(tt.input), end)
+		}
+	}
+}
+
+func TestInvalidImportExportStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"import strings as s;", "1:8: expected next token to be STRING, got IDENT"},
+		{`import "s.monkey" s;`, "1:19: expected next token to be AS, got IDENT"},
+		{`import "s.monkey" as 1;`, "1:22: expected next token to be IDENT, got INT"},
+		{"export x = 1;", "1:8: expected next token to be LET, got IDENT"},
+		{"fn() { export let x = 1; }", "1:8: export is only allowed at the top level"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected an error for %q", test.input)
+			continue
+		}
+		if errors[0].Error() != test.expectedError {
+			t.Errorf("wrong error for %q. expected %q, got %q", test.input, test.expectedError, errors[0])
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	input := `const x = 5; export const add = fn(a, b) { a + b };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok || !stmt.IsConst() {
+		t.Fatalf("program.Statements[0] is not a const statement. got=%s", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Name, "x") || !testLiteralExpression(t, stmt.Value, 5) {
+		return
+	}
+	export, ok := program.Statements[1].(*ast.ExportStatement)
+	if !ok || !export.Let.IsConst() {
+		t.Fatalf("program.Statements[1] is not an exported const. got=%s", program.Statements[1])
+	}
+	if fl, ok := export.Let.Value.(*ast.FunctionLiteral); !ok || fl.Name != "add" {
+		t.Errorf("export.Let.Value is not the function add. got=%s", export.Let.Value)
+	}
+	expected := "const x = 5;export const add = fn add(a, b)(a + b);"
+	if program.String() != expected {
+		t.Errorf("expected %q, got %q", expected, program.String())
+	}
+
+	l = lexer.New("const [a, b] = pair;")
+	p = New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	expectedError := "1:7: expected next token to be IDENT, got ["
+	if len(errors) == 0 || errors[0].Error() != expectedError {
+		t.Errorf("wrong errors. expected %q, got %v", expectedError, errors)
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		param    string
+		catch    bool
+		finally  bool
+		expected string
+	}{
+		{"try { x } catch (e) { e }", "e", true, false, "try x catch (e) e"},
+		{"try { x } catch { 1 }", "", true, false, "try x catch 1"},
+		{"try { x } finally { y }", "", false, true, "try x finally y"},
+		{"try { x } catch (e) { e } finally { y }", "e", true, true, "try x catch (e) e finally y"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		try, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+		if tt.param == "" && try.Param != nil || tt.param != "" && !testIdentifier(t, try.Param, tt.param) {
+			t.Errorf("wrong catch parameter for %q. got=%v", tt.input, try.Param)
+		}
+		if (try.Catch != nil) != tt.catch || (try.Finally != nil) != tt.finally {
+			t.Errorf("wrong blocks for %q. got catch=%v, finally=%v", tt.input, try.Catch, try.Finally)
+		}
+		if try.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, try.String())
+		}
+		if try.End().Offset != len(tt.input) {
+			t.Errorf("wrong end offset for %q. expected %d, got %d", tt.input, len(tt.input), try.End().Offset)
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	l := lexer.New(`throw "boom";`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	if str, ok := stmt.Value.(*ast.StringLiteral); !ok || str.Value != "boom" {
+		t.Errorf("stmt.Value is not the string boom. got=%s", stmt.Value)
+	}
+	if stmt.String() != "throw boom;" {
+		t.Errorf("expected %q, got %q", "throw boom;", stmt.String())
+	}
+}
+
+func TestInvalidTryExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"try { 1 }", "1:10: expected next token to be CATCH or FINALLY, got EOF"},
+		{"try { 1 } catch e { e }", "1:17: expected next token to be {, got IDENT"},
+		{"try { 1 } catch (1) { 2 }", "1:18: expected next token to be IDENT, got INT"},
+		{"try 1 catch { 2 }", "1:5: expected next token to be {, got INT"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected an error for %q", test.input)
+			continue
+		}
+		if errors[0].Error() != test.expectedError {
+			t.Errorf("wrong error for %q. expected %q, got %q", test.input, test.expectedError, errors[0])
+		}
+	}
+}
+
+func TestPropagateExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { x? }", "fn()(x?)"},
+		{"fn() { f(x)?.y }", `fn()((f(x)?)[y])`},
+		{"fn() { -f()? + 1 }", "fn()((-(f()?)) + 1)"},
+		{"fn() { a[0]?? }", "fn()(((a[0])?)?)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("let x = f()?;")
+	p := New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	expected := "1:12: ? outside of function"
+	if len(errors) != 1 || errors[0].Error() != expected {
+		t.Errorf("wrong errors. expected %q, got %v", expected, errors)
+	}
+}
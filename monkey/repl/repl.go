@@ -7,6 +7,7 @@ import (
 	"monkey/compiler"
 	"monkey/eval"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
 	"monkey/vm"
@@ -26,9 +27,18 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
+// Resolver finds the modules imported by the programs the REPL runs
+var Resolver = module.NewResolver()
+
+// CheckedArithmetic makes integer overflow in the programs the REPL runs
+// a runtime error
+var CheckedArithmetic = false
+
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnv()
+	env.CheckedArithmetic = CheckedArithmetic
+	env.Modules = module.NewLoader(Resolver, "")
 	macroEnv := object.NewEnv()
 
 	for {
@@ -43,8 +53,7 @@ func Start(in io.Reader, out io.Writer) {
 		parser := parser.New(lexer)
 		program := parser.ParseProgram()
 
-		if len(parser.Errors()) > 0 {
-			printParserErros(out, parser.Errors())
+		if reportParserErrors(out, line, parser.Errors()) {
 			continue
 		}
 
@@ -66,6 +75,7 @@ func StartCompiled(in io.Reader, out io.Writer) {
 	for i, v := range object.Builtins {
 		symTable.DefineBuiltin(i, v.Name)
 	}
+	modules := module.NewLoader(Resolver, "")
 
 	for {
 		fmt.Fprint(out, PROMPT)
@@ -79,8 +89,7 @@ func StartCompiled(in io.Reader, out io.Writer) {
 		parser := parser.New(lexer)
 		program := parser.ParseProgram()
 
-		if len(parser.Errors()) > 0 {
-			printParserErros(out, parser.Errors())
+		if reportParserErrors(out, line, parser.Errors()) {
 			continue
 		}
 
@@ -94,6 +103,8 @@ func StartCompiled(in io.Reader, out io.Writer) {
 		constants = code.Constants
 
 		machine := vm.NewWithState(compiler.Bytecode(), globals)
+		machine.CheckedArithmetic = CheckedArithmetic
+		machine.Modules = modules
 		err = machine.Run()
 		if err != nil {
 			fmt.Fprintf(out, "Woops Executing bytecode failed:\n%s\n", err)
@@ -105,10 +116,20 @@ func StartCompiled(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErros(out io.Writer, errors []string) {
+// reportParserErrors prints the diagnostics of a line and reports
+// whether any of them is an error, warnings alone don't stop the line
+// from running
+func reportParserErrors(out io.Writer, source string, errors []*parser.ParseError) bool {
+	if parser.HasErrors(errors) {
+		printParserErros(out, source, errors)
+		return true
+	}
+	parser.RenderAll(out, source, errors)
+	return false
+}
+
+func printParserErros(out io.Writer, source string, errors []*parser.ParseError) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Whoops!\nparser errors:\n")
-	for _, message := range errors {
-		io.WriteString(out, "\t"+message+"\n")
-	}
+	parser.RenderAll(out, source, errors)
 }
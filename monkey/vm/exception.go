@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"errors"
+	"monkey/object"
+	"monkey/token"
+)
+
+// handler is the handler of a try expression being run, it catches the
+// exceptions raised until the matching OpEndTry
+type handler struct {
+	// catchPos is where the catch code starts
+	catchPos int
+	// finally is set for the handler of a finally block
+	finally bool
+	// sp and framesIndex are restored before jumping to catchPos
+	sp          int
+	framesIndex int
+}
+
+// exception is the error run returns for a throw statement, pos is
+// set when a finally block throws it on
+type exception struct {
+	value object.Object
+	pos   token.Position
+}
+
+func (e *exception) Error() string {
+	if err, ok := e.value.(*object.Error); ok {
+		return err.Message
+	}
+	return e.value.Inspect()
+}
+
+// raisedAt returns the position err was raised at, pos unless err is
+// an exception thrown on by a finally block
+func raisedAt(err error, pos token.Position) token.Position {
+	var e *exception
+	if errors.As(err, &e) && e.pos.IsValid() {
+		return e.pos
+	}
+	return pos
+}
+
+// catch unwinds the stack to the innermost handler and pushes the value
+// of the exception err, raised at pos, for its catch code. The handler
+// of a finally block gets an uncaught error holding the value instead,
+// so it can throw it on at pos. It reports false if there is no handler
+// left.
+func (vm *VM) catch(err error, pos token.Position) bool {
+	n := len(vm.handlers)
+	if n == 0 {
+		return false
+	}
+	h := vm.handlers[n-1]
+	vm.handlers = vm.handlers[:n-1]
+
+	for vm.framesIndex > h.framesIndex {
+		vm.popFrame()
+	}
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.catchPos - 1
+
+	var value object.Object
+	var e *exception
+	if errors.As(err, &e) {
+		value = e.value
+	} else {
+		value = &object.Error{Message: err.Error(), Pos: pos, Caught: true}
+	}
+	if h.finally {
+		value = &object.Error{Message: err.Error(), Pos: pos, Value: value}
+	}
+	vm.push(value)
+	return true
+}
@@ -0,0 +1,42 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/module"
+	"monkey/object"
+)
+
+func (vm *VM) importModule(path string) (object.Object, error) {
+	if vm.Modules == nil {
+		return nil, fmt.Errorf("cannot import %q without a module loader", path)
+	}
+	return vm.Modules.Import(path, vm.runModule)
+}
+
+// runModule compiles and runs a module in a VM of its own, so each
+// module has its own constants and globals
+func (vm *VM) runModule(program *ast.Program) (object.Object, error) {
+	symTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symTable.DefineBuiltin(i, v.Name)
+	}
+	comp := compiler.NewWithState(symTable, []object.Object{})
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	machine := New(comp.Bytecode())
+	machine.CheckedArithmetic = vm.CheckedArithmetic
+	machine.Modules = vm.Modules
+	err = machine.Run()
+	if err != nil {
+		return nil, err
+	}
+	return module.Exports(program, func(name string) object.Object {
+		symbol, _ := symTable.Resolve(name)
+		return machine.globals[symbol.Index]
+	}), nil
+}
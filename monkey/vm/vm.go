@@ -2,8 +2,10 @@ package vm
 
 import (
 	"fmt"
+	"math"
 	"monkey/code"
 	"monkey/compiler"
+	"monkey/module"
 	"monkey/object"
 )
 
@@ -16,25 +18,41 @@ var False = &object.Boolean{Value: false}
 var Null = &object.Null{}
 
 type VM struct {
+	// CheckedArithmetic makes integer overflow in + - * and / a runtime
+	// error instead of wrapping around.
+	CheckedArithmetic bool
+	// Modules loads the modules of import statements, importing fails
+	// while it is nil
+	Modules *module.Loader
+
 	constants   []object.Object
 	stack       []object.Object
 	sp          int // points to next free slot
 	globals     []object.Object
 	frames      []*Frame
 	framesIndex int
+	// handlers of the try expressions being run, innermost last
+	handlers []handler
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &object.Closure{Fn: mainFn}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
+	mainClosure := &object.Closure{
+		Fn:        mainFn,
+		Constants: bytecode.Constants,
+		Globals:   make([]object.Object, GlobalsSize),
+	}
 	mainFrame := NewFrame(mainClosure, 0)
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
 	return &VM{
-		constants:   bytecode.Constants,
+		constants:   mainClosure.Constants,
 		stack:       make([]object.Object, StackSize),
 		sp:          0,
-		globals:     make([]object.Object, GlobalsSize),
+		globals:     mainClosure.Globals,
 		frames:      frames,
 		framesIndex: 1,
 	}
@@ -43,10 +61,32 @@ func New(bytecode *compiler.Bytecode) *VM {
 func NewWithState(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = s
+	vm.frames[0].cl.Globals = s
 	return vm
 }
 
+// Run executes the bytecode. Runtime errors and exceptions go to the
+// innermost try expression, those that aren't caught are prefixed with
+// the source position of the failing instruction.
 func (vm *VM) Run() error {
+	for {
+		err := vm.run()
+		if err == nil {
+			return nil
+		}
+		frame := vm.currentFrame()
+		pos := raisedAt(err, frame.cl.Fn.SourceMap.Lookup(frame.ip))
+		if vm.catch(err, pos) {
+			continue
+		}
+		if pos.IsValid() {
+			return fmt.Errorf("%s: %w", pos, err)
+		}
+		return err
+	}
+}
+
+func (vm *VM) run() error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
@@ -80,12 +120,36 @@ func (vm *VM) Run() error {
 			localIdx := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIdx)] = vm.pop()
+			slot := &vm.stack[frame.basePointer+int(localIdx)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
 		case code.OpGetLocal:
 			localIdx := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
-			err := vm.push(vm.stack[frame.basePointer+int(localIdx)])
+			local := vm.stack[frame.basePointer+int(localIdx)]
+			if cell, ok := local.(*object.Cell); ok {
+				local = cell.Value
+			}
+			err := vm.push(local)
+			if err != nil {
+				return err
+			}
+		case code.OpGetLocalCell:
+			localIdx := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			// the local moves into a cell the first time it is captured
+			slot := &vm.stack[frame.basePointer+int(localIdx)]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+			err := vm.push(cell)
 			if err != nil {
 				return err
 			}
@@ -103,11 +167,32 @@ func (vm *VM) Run() error {
 			freeIdx := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIdx])
+			free := currentClosure.Free[freeIdx]
+			if cell, ok := free.(*object.Cell); ok {
+				free = cell.Value
+			}
+			err := vm.push(free)
 
 			if err != nil {
 				return err
 			}
+		case code.OpGetFreeCell:
+			freeIdx := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIdx])
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIdx := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			currentClosure := vm.currentFrame().cl
+			cell, ok := currentClosure.Free[freeIdx].(*object.Cell)
+			if !ok {
+				return fmt.Errorf("cannot assign to %s", currentClosure.Free[freeIdx].Type())
+			}
+			cell.Value = vm.pop()
 		case code.OpArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -117,6 +202,18 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpArraySpread:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			array, err := vm.concatArrays(vm.sp-numParts, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numParts
+			err = vm.push(array)
+			if err != nil {
+				return err
+			}
 		case code.OpHash:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -137,6 +234,97 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			exports, err := vm.importModule(vm.constants[constIndex].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+			err = vm.push(exports)
+			if err != nil {
+				return err
+			}
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+
+			slice, err := object.Slice(left, low, high)
+			if err != nil {
+				return err
+			}
+			err = vm.push(slice)
+			if err != nil {
+				return err
+			}
+		case code.OpMatchEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err := vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			hasRest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			array, ok := vm.pop().(*object.Array)
+			matched := ok && (len(array.Elements) == numElements ||
+				hasRest && len(array.Elements) > numElements)
+			err := vm.push(nativeBoolToBooleanObject(matched))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := vm.stack[vm.sp-numKeys : vm.sp]
+			vm.sp -= numKeys
+			hash, ok := vm.pop().(*object.Hash)
+			for _, key := range keys {
+				if !ok {
+					break
+				}
+				_, ok = hash.Pairs[key.(object.Hashable).HashKey()]
+			}
+			err := vm.push(nativeBoolToBooleanObject(ok))
+			if err != nil {
+				return err
+			}
+		case code.OpUnpackArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			hasRest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			err := vm.unpackArray(vm.pop(), numElements, hasRest)
+			if err != nil {
+				return err
+			}
+		case code.OpUnpackHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := make([]object.Object, numKeys)
+			copy(keys, vm.stack[vm.sp-numKeys:vm.sp])
+			vm.sp -= numKeys
+
+			err := vm.unpackHash(vm.pop(), keys)
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
 
 		case code.OpTrue:
 			err := vm.push(True)
@@ -163,12 +351,18 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpBitNot:
+			err := vm.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			err := vm.executeBinaryOparation(op)
 			if err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -185,6 +379,28 @@ func (vm *VM) Run() error {
 			if !isTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpIterInit:
+			iterable := vm.pop()
+			iter, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+			err := vm.push(iter)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			iter := vm.pop().(*object.Iterator)
+			if el, ok := iter.Next(); ok {
+				err := vm.push(el)
+				if err != nil {
+					return err
+				}
+			} else {
+				vm.currentFrame().ip = pos - 1
+			}
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -193,6 +409,59 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetMethod:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+			receiver := vm.pop()
+			method, ok := object.GetMember(receiver, name)
+			if !ok {
+				return fmt.Errorf("undefined method %s for %s", name, receiver.Type())
+			}
+			err := vm.push(method)
+			if err != nil {
+				return err
+			}
+		case code.OpCallSpread:
+			args := vm.pop().(*object.Array)
+			for _, arg := range args.Elements {
+				err := vm.push(arg)
+				if err != nil {
+					return err
+				}
+			}
+			err := vm.executeCall(len(args.Elements))
+			if err != nil {
+				return err
+			}
+		case code.OpTry, code.OpTryFinally:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			vm.handlers = append(vm.handlers, handler{
+				catchPos:    catchPos,
+				finally:     op == code.OpTryFinally,
+				sp:          vm.sp,
+				framesIndex: vm.framesIndex,
+			})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			value := vm.pop()
+			// the handler of a finally block gets an uncaught error
+			// that it throws on from where it was first raised
+			if err, ok := value.(*object.Error); ok && !err.Caught {
+				return &exception{value: err.Value, pos: err.Pos}
+			}
+			return &exception{value: value}
+		case code.OpIsError:
+			// only error values are returned by ?, runtime errors are
+			// raised and never reach it
+			errObj, ok := vm.StackTop().(*object.Error)
+			err := vm.push(nativeBoolToBooleanObject(ok && errObj.Caught))
+			if err != nil {
+				return err
+			}
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure)
@@ -266,6 +535,8 @@ func (vm *VM) executeBinaryOparation(op code.Opcode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && leftType == rightType:
 		return vm.executeBinaryIntegerOparation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOparation(op, left, right)
 	case leftType == object.STRING_OBJ && leftType == rightType:
 		return vm.executeBinaryStringOparation(op, left, right)
 	default:
@@ -277,6 +548,16 @@ func (vm *VM) executeBinaryIntegerOparation(op code.Opcode, left, right object.O
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	if rightVal == 0 && op == code.OpDiv {
+		return fmt.Errorf("division by zero: %d / 0", leftVal)
+	}
+	if rightVal == 0 && op == code.OpMod {
+		return fmt.Errorf("modulo by zero: %d %% 0", leftVal)
+	}
+	if vm.CheckedArithmetic && object.IntegerOverflows(integerOperators[op], leftVal, rightVal) {
+		return fmt.Errorf("integer overflow: %d %s %d", leftVal, integerOperators[op], rightVal)
+	}
+
 	var result int64
 
 	switch op {
@@ -288,6 +569,28 @@ func (vm *VM) executeBinaryIntegerOparation(op code.Opcode, left, right object.O
 		result = leftVal * rightVal
 	case code.OpDiv:
 		result = leftVal / rightVal
+	case code.OpMod:
+		result = object.IntMod(leftVal, rightVal)
+	case code.OpPow:
+		if rightVal < 0 {
+			return vm.push(&object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))})
+		}
+		result = object.IntPow(leftVal, rightVal)
+	case code.OpBitAnd:
+		result = leftVal & rightVal
+	case code.OpBitOr:
+		result = leftVal | rightVal
+	case code.OpBitXor:
+		result = leftVal ^ rightVal
+	case code.OpShiftLeft, code.OpShiftRight:
+		if rightVal < 0 {
+			return fmt.Errorf("negative shift count: %d", rightVal)
+		}
+		if op == code.OpShiftLeft {
+			result = leftVal << rightVal
+		} else {
+			result = leftVal >> rightVal
+		}
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
@@ -295,6 +598,34 @@ func (vm *VM) executeBinaryIntegerOparation(op code.Opcode, left, right object.O
 	return vm.push(&object.Integer{Value: result})
 }
 
+// executeBinaryFloatOparation handles mixed integer and float operands,
+// integers are promoted to floats
+func (vm *VM) executeBinaryFloatOparation(op code.Opcode, left, right object.Object) error {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftVal + rightVal
+	case code.OpSub:
+		result = leftVal - rightVal
+	case code.OpMul:
+		result = leftVal * rightVal
+	case code.OpDiv:
+		result = leftVal / rightVal
+	case code.OpMod:
+		result = math.Mod(leftVal, rightVal)
+	case code.OpPow:
+		result = math.Pow(leftVal, rightVal)
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
 func (vm *VM) executeBinaryStringOparation(op code.Opcode, left, right object.Object) error {
 	if op != code.OpAdd {
 		return fmt.Errorf("unknown string operator: %d", op)
@@ -312,6 +643,9 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
 	switch op {
 	case code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(left == right))
@@ -333,11 +667,39 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftVal > rightVal))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal >= rightVal))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal < rightVal))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal <= rightVal))
 	default:
 		return fmt.Errorf("onknown operator: %d", op)
 	}
 }
 
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal > rightVal))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal >= rightVal))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal < rightVal))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal <= rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
 func (vm *VM) executeBangOperator() error {
 	op := vm.pop()
 	switch op {
@@ -352,11 +714,22 @@ func (vm *VM) executeBangOperator() error {
 
 func (vm *VM) executeMinusOperator() error {
 	op := vm.pop()
-	if op.Type() != object.INTEGER_OBJ {
+	switch op := op.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -op.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -op.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", op.Type())
 	}
-	value := op.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+}
+
+func (vm *VM) executeBitNotOperator() error {
+	op := vm.pop()
+	if op, ok := op.(*object.Integer); ok {
+		return vm.push(&object.Integer{Value: ^op.Value})
+	}
+	return fmt.Errorf("unsupported type for bitwise not: %s", op.Type())
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
@@ -370,6 +743,101 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	}
 }
 
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		arrayObj := left.(*object.Array)
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(arrayObj.Elements)) {
+			return fmt.Errorf("index out of range: %d", i)
+		}
+		arrayObj.Elements[i] = value
+	case left.Type() == object.HASH_OBJ:
+		hashObj := left.(*object.Hash)
+		if hashObj.Exports {
+			return fmt.Errorf("cannot assign to export %s", index.Inspect())
+		}
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		hashObj.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+	return vm.push(value)
+}
+
+// unpackArray pushes the rest of array, if wanted, and then its first
+// numElements elements in reverse, so the first element ends up on top
+func (vm *VM) unpackArray(obj object.Object, numElements int, hasRest bool) error {
+	array, ok := obj.(*object.Array)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as ARRAY", obj.Type())
+	}
+	if !hasRest && len(array.Elements) != numElements {
+		return fmt.Errorf("array pattern expects %d elements, got %d", numElements, len(array.Elements))
+	}
+	if len(array.Elements) < numElements {
+		return fmt.Errorf("array pattern expects at least %d elements, got %d", numElements, len(array.Elements))
+	}
+
+	if hasRest {
+		rest := make([]object.Object, len(array.Elements)-numElements)
+		copy(rest, array.Elements[numElements:])
+		err := vm.push(&object.Array{Elements: rest})
+		if err != nil {
+			return err
+		}
+	}
+	for i := numElements - 1; i >= 0; i-- {
+		err := vm.push(array.Elements[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// concatArrays joins the arrays between startIndex and endIndex on the
+// stack into a new array
+func (vm *VM) concatArrays(startIndex, endIndex int) (object.Object, error) {
+	elements := []object.Object{}
+	for i := startIndex; i < endIndex; i++ {
+		array, ok := vm.stack[i].(*object.Array)
+		if !ok {
+			return nil, fmt.Errorf("cannot spread %s", vm.stack[i].Type())
+		}
+		elements = append(elements, array.Elements...)
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+// unpackHash pushes the values of keys in reverse, so the value of the
+// first key ends up on top
+func (vm *VM) unpackHash(obj object.Object, keys []object.Object) error {
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as HASH", obj.Type())
+	}
+
+	values := make([]object.Object, len(keys))
+	for i, key := range keys {
+		pair, ok := hash.Pairs[key.(object.Hashable).HashKey()]
+		if !ok {
+			return fmt.Errorf("hash pattern key %q not found", key.Inspect())
+		}
+		values[i] = pair.Value
+	}
+	for i := len(values) - 1; i >= 0; i-- {
+		err := vm.push(values[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (vm *VM) executeArrayIndex(left, index object.Object) error {
 	arrayObj := left.(*object.Array)
 	i := index.(*object.Integer).Value
@@ -387,7 +855,9 @@ func (vm *VM) executeHashIndex(left, index object.Object) error {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObj.Pairs[key.HashKey()]
-	if !ok {
+	if !ok && hashObj.Exports {
+		return fmt.Errorf("undefined export %s", index.Inspect())
+	} else if !ok {
 		return vm.push(Null)
 	}
 	return vm.push(pair.Value)
@@ -421,13 +891,20 @@ func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
+// pushFrame and popFrame switch to the constants and globals of the
+// module the closure of the current frame comes from
 func (vm *VM) pushFrame(f *Frame) {
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex += 1
+	vm.constants = f.cl.Constants
+	vm.globals = f.cl.Globals
 }
 
 func (vm *VM) popFrame() *Frame {
 	vm.framesIndex -= 1
+	current := vm.currentFrame().cl
+	vm.constants = current.Constants
+	vm.globals = current.Globals
 	return vm.frames[vm.framesIndex]
 }
 
@@ -456,17 +933,42 @@ func (vm *VM) pushClosure(constIdx, numFree int) error {
 	}
 	vm.sp = vm.sp - numFree
 
-	closure := &object.Closure{Fn: fn, Free: free}
+	closure := &object.Closure{Fn: fn, Free: free, Constants: vm.constants, Globals: vm.globals}
 	return vm.push(closure)
 }
 
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: expected %d, got %d", cl.Fn.NumParameters, numArgs)
+	fn := cl.Fn
+	min, max := fn.Arity()
+	if numArgs < min || max != -1 && numArgs > max {
+		return fmt.Errorf("wrong number of arguments: expected %s, got %d", object.FormatArity(min, max), numArgs)
 	}
+
+	var rest *object.Array
+	if fn.Variadic {
+		rest = &object.Array{Elements: []object.Object{}}
+		if extra := numArgs - fn.NumParameters; extra > 0 {
+			rest.Elements = append(rest.Elements, vm.stack[vm.sp-extra:vm.sp]...)
+			vm.sp -= extra
+			numArgs -= extra
+		}
+	}
+
 	frame := NewFrame(cl, vm.sp-numArgs)
+	if len(fn.Entries) > 0 {
+		// skip the default values of the arguments that were passed
+		frame.ip = fn.Entries[numArgs-fn.MinParameters] - 1
+	}
 	vm.pushFrame(frame)
-	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	vm.sp = frame.basePointer + fn.NumLocals
+	// clear locals left over from earlier calls, a stale cell in a
+	// slot would otherwise be written through by OpSetLocal
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	if rest != nil {
+		vm.stack[frame.basePointer+fn.NumParameters] = rest
+	}
 	return nil
 }
 
@@ -475,6 +977,11 @@ func (vm *VM) callBuiltin(fn *object.Builtin, numArgs int) error {
 	result := fn.Fn(args...)
 	vm.sp -= numArgs + 1
 
+	// builtins report failures as errors, only error values made by
+	// error() are returned to the program
+	if err, ok := result.(*object.Error); ok && !err.Caught {
+		return fmt.Errorf("%s", err.Message)
+	}
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -490,6 +997,28 @@ func nativeBoolToBooleanObject(b bool) *object.Boolean {
 	return False
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+var integerOperators = map[code.Opcode]string{
+	code.OpAdd: "+",
+	code.OpSub: "-",
+	code.OpMul: "*",
+	code.OpDiv: "/",
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj := obj.(type) {
 	case *object.Boolean:
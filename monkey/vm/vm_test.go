@@ -5,8 +5,12 @@ import (
 	"monkey/ast"
 	"monkey/compiler"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -32,6 +36,50 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-5", -5},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"0x10 - 0b1", 15},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"2 * 3 ** 2", 18},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 << 64", 0},
+		{"1 + 2 << 3", 24},
+		{"1 | 2 ^ 3 & 4", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1e-3", 0.001},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"7.5 % 2", 1.5},
+		{"-7.5 % 2", -1.5},
+		{"2 ** -1", 0.5},
+		{"2.0 ** 3", 8.0},
+		{"9 ** 0.5", 3.0},
 	}
 
 	runVmTests(t, tests)
@@ -45,6 +93,13 @@ func TestBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 2", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"1 >= 1", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -81,11 +136,363 @@ func TestConditionals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"if (false) { 1 } || 1", true},
+		{"if (false) { 1 } || false", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"false && 1 + true", false},
+		{"true || 1 + true", true},
+	}
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"while (true) { break; } 5", 5},
+		{"while (false) { 1 } 5", 5},
+		{"let f = fn() { while (true) { return 1; } }; f()", 1},
+		{"for (x in [1, 2, 3]) { x } x", 3},
+		{"let f = fn() { for (x in [1, 2, 3, 4]) { if (x > 2) { return x; } } }; f()", 3},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x < 3) { continue; } return x * 10; } }; f()", 30},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { break; } } x }; f()", 2},
+		{"let f = fn() { for (x in [1, 2]) { for (y in [3, 4, 5]) { if (y == 4) { break; } } } [x, y] }; f()", []int{2, 4}},
+		{"for (c in \"héllo\") { } c", "o"},
+		{"let f = fn(s) { for (c in s) { return c; } }; f(\"日本\")", "日"},
+		{"let f = fn(h) { for (k in h) { return k; } }; f({\"b\": 1, \"a\": 2})", "a"},
+		{"let f = fn(h) { for (k in h) { return k; } }; f({2: 1, -1: 2, 1: 3})", -1},
+		{"let f = fn() { for (x in []) { return 1; } }; f()", Null},
+		{"let i = 0; while (i < 5) { let i = i + 1; } i", 5},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } } i", 3},
+		{"let i = 0; let n = 0; while (i < 5) { let i = i + 1; if (i % 2 == 0) { continue; } let n = n + i; } n", 9},
+		{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; } sum", 6},
+		{"let s = \"\"; for (c in \"héllo\") { let s = c + s; } s", "olléh"},
+		{"let s = \"\"; for (k in {\"b\": 1, \"a\": 2, \"c\": 3}) { let s = s + k; } s", "abc"},
+		{"let n = 0; for (k in {2: 1, -1: 2, 1: 3}) { let n = n * 10 + k; } n", -88},
+		{"let f = fn() { let i = 0; while (i < 5) { let i = i + 1; } i }; f()", 5},
+		{"let n = 0; while (true) { n = n + 1; if (n == 2) { break; } else { 0 } + 1; } n", 2},
+		{"let i = 0; while (i < 3000) { i = i + 1; if (true) { continue; } + 1; } i", 3000},
+		{"let n = 0; while (true) { n = n + 1; let y = [1, if (true) { while (true) { break; } 5 }]; if (n == 2) { break; } } n", 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = x + 1; x", 2},
+		{"let x = 1; x = 5", 5},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let x = 1; let f = fn() { x = 10; }; f(); x", 10},
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let f = fn(x) { let g = fn() { x = x * 2 }; g(); g(); x }; f(3)", 12},
+		{"let f = fn() { let n = 0; let g = fn() { let h = fn() { n = n + 1 }; h(); h() }; g(); n }; f()", 2},
+		{"let mk = fn(v) { let x = v; fn() { x } }; let a = mk(1); let b = mk(2); a() + b() * 10", 21},
+		{"let a = [1, 2, 3]; a[1] = 5; a[0] + a[1] + a[2]", 9},
+		{"let h = {}; h[\"k\"] = 2; h[\"k\"] * 3", 6},
+		{"let a = [1, 2]; let b = a; b[0] = 7; a[0]", 7},
+		{"let i = 0; let sum = 0; while (i < 5) { i = i + 1; sum = sum + i; } sum", 15},
+	}
+	runVmTests(t, tests)
+}
+
+func TestPipeOperator(t *testing.T) {
+	tests := []vmTestCase{
+		{"let double = fn(x) { x * 2 }; 3 |> double", 6},
+		{"let add = fn(a, b) { a + b }; 1 |> add(2) |> add(3)", 6},
+		{"[1, 2, 3] |> push(4) |> len", 4},
+		{"[1, 2, 3] |> tail |> head", 2},
+		{"2 |> fn(x) { x * x }", 4},
+		{"1 + 2 |> fn(x) { x * 10 }", 30},
+	}
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let [first, ...rest] = [1, 2, 3]; first + len(rest) * 10", 21},
+		{"let [...all] = []; len(all)", 0},
+		{"let {name, age} = {\"name\": \"x\", \"age\": 3}; age", 3},
+		{"let {pos: [x, y]} = {\"pos\": [4, 5]}; x * y", 20},
+		{"let f = fn([a, b], {c}) { a + b + c }; f([1, 2], {\"c\": 3})", 6},
+		{"let f = fn(x) { let [a, ...b] = x; fn() { a + len(b) } }; f([5, 6, 7])()", 7},
+		{"let [a, b] = [1, 2]; let [a, b] = [b, a]; a * 10 + b", 21},
+	}
+	runVmTests(t, tests)
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1)", 3},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1, 5)", 6},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1, 5, 7)", 7},
+		{"let f = fn(...xs) { len(xs) }; f()", 0},
+		{"let f = fn(...xs) { len(xs) }; f(1, 2, 3)", 3},
+		{"let f = fn(a, ...xs) { a + len(xs) }; f(1, 2, 3)", 3},
+		{"let f = fn(a = 1, ...xs) { a * 10 + len(xs) }; f()", 10},
+		{"let f = fn(a = 1, ...xs) { a * 10 + len(xs) }; f(2)", 20},
+		{"let f = fn(a = 1, ...xs) { a * 10 + len(xs) }; f(2, 3, 4)", 22},
+		{"let f = fn(a, ...xs) { fn() { xs[0] } }; f(1, 7)()", 7},
+		{"let n = 1; let f = fn(a = n) { a }; n = 5; f()", 5},
+		{"let f = fn([a, b] = [1, 2]) { a + b }; f()", 3},
+		{"let make = fn(x) { fn(y = x) { y } }; make(4)()", 4},
+		{"let f = fn(a = 1) { let b = 2; a + b }; f() + f(3)", 8},
+	}
+	runVmTests(t, tests)
+}
+
+func TestSpread(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2]; let b = [4]; [...a, 3, ...b]", []int{1, 2, 3, 4}},
+		{"[...[], ...[]]", []int{}},
+		{"let a = [1, 2]; let b = [...a]; b[0] = 5; a[0]", 1},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)", 6},
+		{"let f = fn(...xs) { len(xs) }; let g = fn(...xs) { f(0, ...xs) }; g(1, 2)", 3},
+		{"let f = fn(a, b = 10) { a + b }; f(...[1])", 11},
+		{"len(...[[1, 2, 3]])", 3},
+		{"[1, 2] |> fn(...xs) { len(xs) }(...[3])", 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"match (1) { 1 => 10, _ => 20 }", 10},
+		{"match (2) { 1 => 10, _ => 20 }", 20},
+		{"match (-1) { -1 => 1, _ => 2 }", 1},
+		{"match (\"b\") { \"a\" => 1, \"b\" => 2, _ => 3 }", 2},
+		{"match (1) { true => 1, 1.0 => 2, 1 => 3, _ => 4 }", 2},
+		{"match (5) { n => n * 2 }", 10},
+		{"match ([1, 2]) { [a] => a, [a, b] => a + b, _ => 0 }", 3},
+		{"match ([1, 2, 3]) { [1, ...rest] => len(rest), _ => 0 }", 2},
+		{"match ([1, 2, 3]) { [2, ...rest] => len(rest), [_, x, _] => x }", 2},
+		{"match ([]) { [_, ..._] => 1, [] => 2 }", 2},
+		{"match ({\"kind\": \"click\", \"pos\": [3, 4]}) { {kind: \"key\"} => 0, {kind: \"click\", pos: [x, y]} => x * y, _ => -1 }", 12},
+		{"match ({\"a\": 1}) { {b} => b, {a} => a }", 1},
+		{"match (\"a\") { [x] => x, {x} => x, x => 9 }", 9},
+		{"match (7) { n if n < 5 => 1, n if n < 10 => 2, _ => 3 }", 2},
+		{"let f = fn(x) { match (x) { [h, ...t] => h + f(t), [] => 0 } }; f([1, 2, 3, 4])", 10},
+		{"let f = fn(v) { match (v) { [a, b] => match (a) { 1 => b, _ => a }, _ => 0 } }; f([1, 5]) + f([2, 5])", 7},
+		{"match (3) { x => fn() { x } }()", 3},
+		{"match (3) { 1 => 1, 2 => 2 }", Null},
+		{`match (1.0) { 1 => "int", _ => "other" }`, "int"},
+		{"let f = fn() { let y = 1; match (y) { 2 => 2 } }; f()", Null},
+		{"let a = 100; match ([1, 2]) { [a, 5] => a, _ => a }", 100},
+		{"let a = 100; match ([1, 2]) { [a, 5] => a, _ => 0 }; a", 100},
+		{"let a = 100; match (7) { a if a < 5 => 1, _ => 2 }; a", 100},
+		{"let f = fn() { let a = 100; match ([1, [2]]) { [a, [3]] => 0, [_, [b]] => a + b } }; f()", 102},
+		{"let a = 1; match ([5, 6]) { [a, b] => 0 }; a", 1},
+		{"let x = 5; let y = match (3) { x => x * 2 }; x + y", 11},
+		{"const x = 1; match (2) { x => x }", 2},
+		{"let a = 1; match (2) { x => if (true) { let a = x; a } }; a", 1},
+		{"match (4) { a if a > 2 => a, _ => 0 }", 4},
+	}
+	runVmTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`let h = {"name": "monkey"}; h.name`, "monkey"},
+		{`let h = {"a": {"b": 2}}; h.a.b`, 2},
+		{`let h = {"n": 1}; h.n = h.n + 1; h.n`, 2},
+		{`let h = {}; h.missing`, Null},
+		{`[1, 2, 3].len()`, 3},
+		{`"monkey".len()`, 6},
+		{`[1, 2, 3].first() + [1, 2, 3].last()`, 4},
+		{`[1, 2].push(3)`, []int{1, 2, 3}},
+		{`[1, 2, 3].rest().len()`, 2},
+		{`[1, 2, 3].join("-")`, "1-2-3"},
+		{`"a,b,c".split(",").len()`, 3},
+		{`"a,b,c".split(",")[1]`, "b"},
+		{`" Hi ".trim().upper() + "X".lower()`, "HIx"},
+		{`{"b": 2, "a": 1}.keys().join("")`, "ab"},
+		{`{"b": 2, "a": 1}.values()`, []int{1, 2}},
+		{`let m = {"double": fn(x) { x * 2 }, "keys": fn() { 1 }}; m.double(4) + m.keys()`, 9},
+		{`let args = [","]; "a,b".split(...args).len()`, 2},
+		{`3 |> [1, 2].push() |> len`, 3},
+		{`"-" |> "a-b".split() |> len`, 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestSlices(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"let a = [1, 2]; let b = a[:]; b[0] = 5; a", []int{1, 2}},
+		{`"monkey"[1:4]`, "onk"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[:0]`, ""},
+		{`"héllo"[1:3]`, "él"},
+	}
+	runVmTests(t, tests)
+}
+
+var moduleFiles = map[string]string{
+	"lib/strings.monkey": `
+		import "counter.monkey" as c;
+		export let shout = fn(s) { s.upper() + "!" };
+		export let [first, second] = ["a", "b"];
+		let hidden = 1;
+		c.bump();
+	`,
+	"lib/counter.monkey": `
+		let n = 0;
+		export let bump = fn() { n = n + 1; n };
+		export let count = fn() { n };
+	`,
+	"broken.monkey":  `export let x = -true;`,
+	"cycle_a.monkey": `import "cycle_b.monkey" as b;`,
+	"cycle_b.monkey": `import "cycle_a.monkey" as a;`,
+}
+
+// writeModules writes moduleFiles to a new directory and returns a
+// loader for a main program in it
+func writeModules(t *testing.T) (*module.Loader, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range moduleFiles {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return module.NewLoader(module.NewResolver(), filepath.Join(dir, "main.monkey")), dir
+}
+
+func TestImports(t *testing.T) {
+	tests := []vmTestCase{
+		{`import "lib/strings.monkey" as s; s.shout("hi")`, "HI!"},
+		{`import "lib/strings.monkey" as s; s.first + s.second`, "ab"},
+		{`import "lib/strings.monkey" as s; import "lib/counter.monkey" as c; c.bump(); c.count()`, 2},
+		{`let n = 100; import "lib/counter.monkey" as c; c.bump() + n`, 101},
+		{`let f = fn() { import "lib/counter.monkey" as c; c.count() }; f()`, 0},
+		{`import "lib/strings.monkey" as s; let t = try { s.first = "z" } catch (e) { 0 }; import "lib/strings.monkey" as u; u.first`, "a"},
+	}
+
+	for _, test := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		vm.Modules, _ = writeModules(t)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, test.expected, vm.LastPoppedStackElement())
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`import "nope.monkey" as n;`, `1:1: module "nope.monkey" not found`},
+		{`import "cycle_a.monkey" as a;`, "1:1: import cycle: DIR/cycle_a.monkey -> DIR/cycle_b.monkey -> DIR/cycle_a.monkey"},
+		{`import "broken.monkey" as b;`, "1:1: DIR/broken.monkey:1:16: "},
+		{`import "lib/strings.monkey" as s; s.hidden`, "1:35: undefined export hidden"},
+		{`import "lib/strings.monkey" as s; s.first = "z"`, "1:35: cannot assign to export first"},
+	}
+
+	for _, test := range errorTests {
+		comp := compiler.New()
+		err := comp.Compile(parse(test.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		var dir string
+		vm.Modules, dir = writeModules(t)
+		err = vm.Run()
+		if err == nil {
+			t.Errorf("expected a vm error for %q", test.input)
+			continue
+		}
+		expected := strings.ReplaceAll(test.expectedError, "DIR", dir)
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("wrong vm error. expected %q in %q", expected, err)
+		}
+	}
+}
+
+func TestErrorPropagation(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn() { let x = error("bad")?; 1 }; f().message()`, "bad"},
+		{"let f = fn(x) { x? + 1 }; f(1)", 2},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } len(s) }; let total = fn(a, b) { parse(a)? + parse(b)? }; total("ab", "c")`, 3},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } len(s) }; let total = fn(a, b) { parse(a)? + parse(b)? }; total("ab", "").message()`, "empty"},
+		{`let f = fn() { [1, error("e")?, 3] }; f().message()`, "e"},
+		{`let f = fn() { for (x in [1, 2]) { error("in loop")? } 5 }; f().message()`, "in loop"},
+		{`let r = 0; let f = fn() { try { error("e")? } finally { r = 1 } }; f(); r`, 1},
+		{`let f = fn() { try { error("e")? } catch (e) { 2 } }; f().message()`, "e"},
+		{`let f = fn() { try { error("e")? } catch (e) { 2 } }; f(); try { throw 1 } catch (e) { e }`, 1},
+		{`error("x").message()`, "x"},
+		{`let e = error("x"); 5`, 5},
+		{`let f = fn() { let e = try { 1 / 0 } catch (e) { e }; e?; 5 }; f().message()`, "division by zero: 1 / 0"},
+		{"let f = fn() { len(1)?; 5 }; try { f() } catch (e) { e.message() }", "argument to `len` not supported, got INTEGER"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e + 1 }", 6},
+		{"try { 1 / 0 } catch (e) { e.message() }", "division by zero: 1 / 0"},
+		{`try { len(1) } catch (e) { "caught" }`, "caught"},
+		{"try { len(1) } catch (e) { e.message() }", "argument to `len` not supported, got INTEGER"},
+		{"try { throw [1, 2] } catch (e) { len(e) }", 2},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() + 1 }; try { g() } catch (e) { e }`, "deep"},
+		{"1 + try { [2, 3][fn() { throw 4 }()] } catch (e) { e }", 5},
+		{"try { throw 1 } catch { 2 }", 2},
+		{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", 20},
+		{"let r = 0; try { r = 1 } finally { r = r + 10 }; r", 11},
+		{"let r = 0; try { try { throw 1 } finally { r = 10 } } catch (e) { r + e }", 11},
+		{"let r = 0; try { try { throw 1 } catch (e) { throw 2 } finally { r = 10 } } catch (e) { r + e }", 12},
+		{"let r = 0; let f = fn() { try { return 1 } finally { r = 5 } }; f() + r", 6},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break } n = n + x } finally { n = n + 10 } } n", 21},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue } n = n + x } catch { n = 100 } } try { throw 1 } catch (e) { n + e }", 5},
+		{"let f = fn() { try { return 1 } catch (e) { 2 } }; f(); try { throw 3 } catch (e) { e }", 3},
+		{"let x = 1; try { throw 2 } catch (x) { x }; x", 1},
+		{"const e = 1; try { throw 2 } catch (e) { e }", 2},
+		{"let x = 1; try { throw 2 } catch (e) { let x = e; x } finally { 0 }; x", 1},
+		{"let e = try { 1 / 0 } catch (e) { e }; 5", 5},
+		{"try { let a = 1; } catch (e) { 2 }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []vmTestCase{
 		{"let one = 1; one", 1},
 		{"let one = 1; let two = 2; one + two", 3},
 		{"let one = 1; let two = one + one; one + two", 3},
+		{"const one = 1; const two = one + one; one + two", 3},
+		{"const one = 1; let f = fn() { let one = 2; one }; f() + one", 3},
 	}
 	runVmTests(t, tests)
 }
@@ -144,6 +551,9 @@ func TestIndexExpressions(t *testing.T) {
 		{"{1: 2, 3: 4}[3]", 4},
 		{"{1: 2}[3]", Null},
 		{"{}[0]", Null},
+		{"{1: 2}[1.0]", 2},
+		{"{2.0: 4}[2]", 4},
+		{"{1: 2}[1.5]", Null},
 	}
 	runVmTests(t, tests)
 }
@@ -286,15 +696,23 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
 			input:    `fn() { 1; }(1);`,
-			expected: `wrong number of arguments: expected 0, got 1`,
+			expected: `1:1: wrong number of arguments: expected 0, got 1`,
 		},
 		{
 			input:    `fn(a) { a; }();`,
-			expected: `wrong number of arguments: expected 1, got 0`,
+			expected: `1:1: wrong number of arguments: expected 1, got 0`,
 		},
 		{
 			input:    `fn(a, b) { a + b; }(1);`,
-			expected: `wrong number of arguments: expected 2, got 1`,
+			expected: `1:1: wrong number of arguments: expected 2, got 1`,
+		},
+		{
+			input:    `fn(a, b = 1) { a; }(1, 2, 3);`,
+			expected: `1:1: wrong number of arguments: expected 1 to 2, got 3`,
+		},
+		{
+			input:    `fn(a, ...b) { a; }();`,
+			expected: `1:1: wrong number of arguments: expected at least 1, got 0`,
 		},
 	}
 	for _, test := range tests {
@@ -315,6 +733,183 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestRuntimeErrorPositions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    "let x = 1;\nx + \"two\";",
+			expected: "2:1: unsupported types for binary operation: INTEGER STRING",
+		},
+		{
+			input:    "let f = fn(a) {\n  -a\n};\nf(true);",
+			expected: "2:3: unsupported type for negation: BOOLEAN",
+		},
+		{
+			input:    "let n = -1;\n1 << n",
+			expected: "2:1: negative shift count: -1",
+		},
+		{
+			input:    "let f = fn(a) {\n  a / 0\n};\nf(5);",
+			expected: "2:3: division by zero: 5 / 0",
+		},
+		{
+			input:    "5 % 0",
+			expected: "1:1: modulo by zero: 5 % 0",
+		},
+		{
+			input:    "~1.5",
+			expected: "1:1: unsupported type for bitwise not: FLOAT",
+		},
+		{
+			input:    "for (x in 1) { x }",
+			expected: "1:1: cannot iterate over INTEGER",
+		},
+		{
+			input:    "let a = [1];\na[5] = 2",
+			expected: "2:1: index out of range: 5",
+		},
+		{
+			input:    "1[0] = 2",
+			expected: "1:1: index assignment not supported: INTEGER",
+		},
+		{
+			input:    "len(1)",
+			expected: "1:1: argument to `len` not supported, got INTEGER",
+		},
+		{
+			input:    `len("one", "two")`,
+			expected: "1:1: wrong number of arguments. got 2, expected 1",
+		},
+		{
+			input:    "let x = 1;\ntail(x)",
+			expected: "2:1: argument to `tail` must be ARRAY, got INTEGER",
+		},
+		{
+			input:    "push(1, 1)",
+			expected: "1:1: argument to `push` must be ARRAY, got INTEGER",
+		},
+		{
+			input:    `"a".split()`,
+			expected: "1:1: wrong number of arguments. got 0, expected 1",
+		},
+		{
+			input:    "[1].len(2)",
+			expected: "1:1: wrong number of arguments. got 1, expected 0",
+		},
+		{
+			input:    "let [a, b] = [1];",
+			expected: "1:1: array pattern expects 2 elements, got 1",
+		},
+		{
+			input:    "let [a, ...b] = [];",
+			expected: "1:1: array pattern expects at least 1 elements, got 0",
+		},
+		{
+			input:    "let [a] = 1;",
+			expected: "1:1: cannot destructure INTEGER as ARRAY",
+		},
+		{
+			input:    "let {a} = [1];",
+			expected: "1:1: cannot destructure ARRAY as HASH",
+		},
+		{
+			input:    "let {a} = {\"b\": 1};",
+			expected: "1:1: hash pattern key \"a\" not found",
+		},
+		{
+			input:    "[1, 2][true:]",
+			expected: "1:1: slice index must be INTEGER, got BOOLEAN",
+		},
+		{
+			input:    "1[0:]",
+			expected: "1:1: slice operator not supported: INTEGER",
+		},
+		{
+			input:    "1.foo()",
+			expected: "1:1: undefined method foo for INTEGER",
+		},
+		{
+			input:    "let f = fn() {\n  throw \"boom\"\n};\nf()",
+			expected: "2:3: boom",
+		},
+		{
+			input:    "try { throw {} } finally { 1 }",
+			expected: "1:7: {}",
+		},
+		{
+			input:    "try { throw 1 } catch (e) { throw e + 1 } finally { 0 }",
+			expected: "1:29: 2",
+		},
+		{
+			input:    "try { try { -true } finally { 1 } } finally { 2 }",
+			expected: "1:13: unsupported type for negation: BOOLEAN",
+		},
+		{
+			input:    "try { 1 } catch (e) { 2 } finally { -true }",
+			expected: "1:37: unsupported type for negation: BOOLEAN",
+		},
+		{
+			input:    "[1, ...2]",
+			expected: "1:1: cannot spread INTEGER",
+		},
+		{
+			input:    "let f = fn(a) { a }; f(...[1, 2])",
+			expected: "1:22: wrong number of arguments: expected 1, got 2",
+		},
+	}
+	for _, test := range tests {
+		program := parse(test.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != test.expected {
+			t.Errorf("wrong VM error: expected %q, got %q", test.expected, err)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"(-9223372036854775807 - 1) * -1", "integer overflow: -9223372036854775808 * -1"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-4611686018427387904 * 2", -9223372036854775808},
+		{"5.5 * 2", 11.0},
+	}
+
+	for _, test := range tests {
+		program := parse(test.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		vm.CheckedArithmetic = true
+		err = vm.Run()
+
+		if expected, ok := test.expected.(string); ok {
+			if err == nil || !strings.HasSuffix(err.Error(), ": "+expected) {
+				t.Errorf("wrong VM error: expected %q, got %v", expected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, test.expected, vm.LastPoppedStackElement())
+	}
+}
+
 func TestFunctionsWithoutReturnValue(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -358,35 +953,17 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{
-			`len(1)`,
-			&object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
-			},
-		},
-		{
-			`len("one", "two")`,
-			&object.Error{
-				Message: "wrong number of arguments. got 2, expected 1",
-			},
-		},
 		{`len([])`, 0},
 		{`len([1, 2, 3])`, 3},
 		{`print("hello", "world")`, Null},
 		{`first([1, 2, 4])`, 1},
 		{`first([])`, Null},
 		{`last([1, 2, 3])`, 3},
-		{
-			`tail(1)`,
-			&object.Error{
-				Message: "argument to `tail` must be ARRAY, got INTEGER",
-			},
-		},
 		{`push([], 1)`, []int{1}},
 		{
-			`push(1, 1)`,
+			`error("failed")`,
 			&object.Error{
-				Message: "argument to `push` must be ARRAY, got INTEGER",
+				Message: "failed",
 			},
 		},
 	}
@@ -595,6 +1172,11 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("test boolean object failed:\n%s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("test float object failed:\n%s", err)
+		}
 	case string:
 		err := testStringObject(expected, actual)
 		if err != nil {
@@ -661,6 +1243,17 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object ist not of type Float. got %T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got %g, expected %g", result.Value, expected)
+	}
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {